@@ -0,0 +1,161 @@
+package clean
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mergermarket/cdflow2/command"
+	"github.com/mergermarket/cdflow2/docker"
+	"github.com/mergermarket/cdflow2/util"
+)
+
+// DefaultOlderThan is the default for --older-than. Resources newer than this are never removed, since a process on
+// the same host in another PID namespace (e.g. CI runners in containers with host networking) can look dead.
+const DefaultOlderThan = time.Hour
+
+// CommandArgs contains specific arguments to the clean command.
+type CommandArgs struct {
+	OlderThan time.Duration
+	DryRun    bool
+	AllHosts  bool
+}
+
+// NewArgParser returns the parser for the clean options and arguments, which sets result.
+func NewArgParser(result *CommandArgs) *command.ArgParser {
+	return &command.ArgParser{
+		Name: "clean",
+		Options: []command.Option{
+			command.Value("older-than", "o", func(value string) error {
+				olderThan, err := time.ParseDuration(value)
+				if err != nil {
+					return fmt.Errorf("invalid duration for --older-than: %w", err)
+				}
+				result.OlderThan = olderThan
+				return nil
+			}),
+			command.Flag("dry-run", "n", func() { result.DryRun = true }),
+			command.Flag("all-hosts", "a", func() { result.AllHosts = true }),
+		},
+	}
+}
+
+// ParseArgs parses command line arguments to the clean subcommand.
+func ParseArgs(args []string) (*CommandArgs, error) {
+	result := CommandArgs{OlderThan: DefaultOlderThan}
+
+	parser := NewArgParser(&result)
+	if _, err := parser.Parse(args); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// IsOrphaned returns true if a resource is older than olderThan and the process that created it is no longer running.
+// Whether the process is running can only be checked on the same host, so resources from other hosts (e.g. other CI
+// agents sharing a docker daemon), or without a hostname or process ID, are never orphaned unless allHosts is set, in
+// which case they are assumed to be.
+func IsOrphaned(resource *docker.Resource, now time.Time, olderThan time.Duration, hostname string, allHosts bool, processRunning func(pid int) bool) bool {
+	if now.Sub(resource.Created) < olderThan {
+		return false
+	}
+	if resource.Hostname == "" || resource.Hostname != hostname || resource.PID == 0 {
+		return allHosts
+	}
+	return !processRunning(resource.PID)
+}
+
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" { // FindProcess fails on windows if the process doesn't exist
+		return true
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func describe(kind string, resource *docker.Resource, now time.Time) string {
+	return fmt.Sprintf(
+		"%s %s (run %s, pid %d on %s, created %s ago)",
+		kind, resource.Name, resource.RunID, resource.PID, resource.Hostname, now.Sub(resource.Created).Round(time.Second),
+	)
+}
+
+// RunCommand runs the clean command.
+func RunCommand(ctx context.Context, state *command.GlobalState, args *CommandArgs) error {
+	dockerClient := state.DockerClient
+	now := time.Now()
+	hostname, _ := os.Hostname()
+
+	containers, err := dockerClient.ListContainers()
+	if err != nil {
+		return fmt.Errorf("error listing containers: %w", err)
+	}
+	volumes, err := dockerClient.ListVolumes()
+	if err != nil {
+		return fmt.Errorf("error listing volumes: %w", err)
+	}
+
+	action := "removing"
+	if args.DryRun {
+		action = "would remove"
+	}
+
+	var failures []string
+	removed := 0
+
+	// containers first, since volumes can't be removed while a container is using them
+	for _, container := range containers {
+		if !IsOrphaned(container, now, args.OlderThan, hostname, args.AllHosts, processRunning) {
+			continue
+		}
+		fmt.Fprintf(state.ErrorStream, "%s\n", util.FormatInfo(action+" "+describe("container", container, now)))
+		if args.DryRun {
+			continue
+		}
+		if container.Running {
+			if err := dockerClient.Stop(ctx, container.ID, 2); err != nil {
+				failures = append(failures, fmt.Sprintf("error stopping container %s: %v", container.Name, err))
+				continue
+			}
+		}
+		if err := dockerClient.RemoveContainer(container.ID); err != nil {
+			failures = append(failures, fmt.Sprintf("error removing container %s: %v", container.Name, err))
+			continue
+		}
+		removed++
+	}
+
+	for _, volume := range volumes {
+		if !IsOrphaned(volume, now, args.OlderThan, hostname, args.AllHosts, processRunning) {
+			continue
+		}
+		fmt.Fprintf(state.ErrorStream, "%s\n", util.FormatInfo(action+" "+describe("volume", volume, now)))
+		if args.DryRun {
+			continue
+		}
+		if err := dockerClient.RemoveVolume(volume.ID); err != nil {
+			failures = append(failures, fmt.Sprintf("error removing volume %s: %v", volume.Name, err))
+			continue
+		}
+		removed++
+	}
+
+	if !args.DryRun {
+		fmt.Fprintf(state.ErrorStream, "%s\n", util.FormatInfo(fmt.Sprintf("removed %d container(s) and volume(s)", removed)))
+	}
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package clean_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mergermarket/cdflow2/clean"
+	"github.com/mergermarket/cdflow2/docker"
+)
+
+func TestParseArgs(t *testing.T) {
+	args, err := clean.ParseArgs([]string{"--older-than", "1h30m", "--dry-run", "--all-hosts"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if args.OlderThan != 90*time.Minute {
+		t.Errorf("OlderThan: got %v want 1h30m", args.OlderThan)
+	}
+	if !args.DryRun {
+		t.Error("DryRun: got false want true")
+	}
+	if !args.AllHosts {
+		t.Error("AllHosts: got false want true")
+	}
+
+	args, err = clean.ParseArgs([]string{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if args.OlderThan != clean.DefaultOlderThan {
+		t.Errorf("OlderThan: got %v want %v", args.OlderThan, clean.DefaultOlderThan)
+	}
+
+	for name, args := range map[string][]string{
+		"bad duration":   {"--older-than", "soon"},
+		"missing value":  {"--older-than"},
+		"unknown arg":    {"everything"},
+		"unknown option": {"--force"},
+	} {
+		t.Run("sad path - "+name, func(t *testing.T) {
+			if _, err := clean.ParseArgs(args); err == nil {
+				t.Error("Error expected, but got nil")
+			}
+		})
+	}
+}
+
+func TestIsOrphaned(t *testing.T) {
+	now := time.Now()
+	running := func(pid int) bool { return pid == 100 }
+
+	for _, tc := range []struct {
+		name      string
+		resource  docker.Resource
+		olderThan time.Duration
+		allHosts  bool
+		want      bool
+	}{
+		{"dead process", docker.Resource{Created: now.Add(-time.Minute), PID: 200, Hostname: "agent"}, 0, false, true},
+		{"running process", docker.Resource{Created: now.Add(-time.Minute), PID: 100, Hostname: "agent"}, 0, false, false},
+		{"other host", docker.Resource{Created: now.Add(-time.Minute), PID: 200, Hostname: "other"}, 0, false, false},
+		{"other host with all hosts", docker.Resource{Created: now.Add(-time.Minute), PID: 100, Hostname: "other"}, 0, true, true},
+		{"other host with all hosts too new", docker.Resource{Created: now.Add(-time.Minute), PID: 200, Hostname: "other"}, time.Hour, true, false},
+		{"too new", docker.Resource{Created: now.Add(-time.Minute), PID: 200, Hostname: "agent"}, time.Hour, false, false},
+		{"old enough", docker.Resource{Created: now.Add(-2 * time.Hour), PID: 200, Hostname: "agent"}, time.Hour, false, true},
+		{"no pid", docker.Resource{Created: now.Add(-time.Minute), Hostname: "agent"}, 0, false, false},
+		{"no hostname", docker.Resource{Created: now.Add(-time.Minute), PID: 200}, 0, false, false},
+		{"no pid with all hosts", docker.Resource{Created: now.Add(-time.Minute), Hostname: "agent"}, 0, true, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := clean.IsOrphaned(&tc.resource, now, tc.olderThan, "agent", tc.allHosts, running); got != tc.want {
+				t.Errorf("got %t want %t", got, tc.want)
+			}
+		})
+	}
+}
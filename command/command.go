@@ -22,6 +22,13 @@ func (Failure) Error() string {
 	return ""
 }
 
+const (
+	// OutputText is the default for the --output global option, only writing human readable output.
+	OutputText = "text"
+	// OutputJSON for the --output global option writes a JSON summary of the command to stdout.
+	OutputJSON = "json"
+)
+
 // GlobalArgs represents the global (non command specific) arguments.
 type GlobalArgs struct {
 	Command         string
@@ -32,6 +39,8 @@ type GlobalArgs struct {
 	NoPullRelease   bool
 	NoPullTerraform bool
 	NoPullScan      bool
+	Output          string
+	ResultFile      string
 }
 
 // GlobalState contains common to all commands.
@@ -47,6 +56,8 @@ type GlobalState struct {
 	ErrorStream       io.Writer
 	DockerClient      docker.Iface
 	MonitoringClient  *monitoring.DatadogClient
+	// Result is the machine readable summary of the command, nil unless --output json or --result-file was passed.
+	Result *Result
 }
 
 // GetGlobalState collects info common to every command.
@@ -127,96 +138,63 @@ func overrideConfigManifestParams(state *GlobalState) error {
 	return nil
 }
 
-func handleArg(arg string, globalArgs *GlobalArgs, take func() (string, error)) (bool, error) {
-	if strings.HasPrefix(arg, "-") {
-		if handleSimpleFlag(arg, globalArgs) {
-			return false, nil
-		}
-		return handleFlag(arg, globalArgs, take)
-	}
-	globalArgs.Command = arg
-	return true, nil
-}
-
-func handleSimpleFlag(arg string, globalArgs *GlobalArgs) bool {
-	if arg == "--no-pull-config" {
-		globalArgs.NoPullConfig = true
-		return true
-	} else if arg == "--no-pull-release" {
-		globalArgs.NoPullRelease = true
-		return true
-	} else if arg == "--no-pull-terraform" {
-		globalArgs.NoPullTerraform = true
-		return true
-	} else if arg == "--no-pull-scan" {
-		globalArgs.NoPullScan = true
-		return true
-	} else if arg == "--quiet" || arg == "-q" {
-		fmt.Fprintf(os.Stderr, "Quiet flag is deprecated, please remove from your command.\n")
-		return true
-	}
-	return false
-}
-
-func handleFlag(arg string, globalArgs *GlobalArgs, take func() (string, error)) (bool, error) {
-	if arg == "--config-param" {
-		value, err := take()
-		if err != nil {
-			return false, err
-		}
-		globalArgs.ConfigParams = append(globalArgs.ConfigParams, value)
-	} else if arg == "-c" || arg == "--component" {
-		value, err := take()
-		if err != nil {
-			return false, err
-		}
-		globalArgs.Component = value
-	} else if strings.HasPrefix(arg, "--component=") {
-		globalArgs.Component = strings.TrimPrefix(arg, "--component=")
-	} else if arg == "--commit" {
-		value, err := take()
-		if err != nil {
-			return false, err
-		}
-		globalArgs.Commit = value
-	} else if strings.HasPrefix(arg, "--commit=") {
-		globalArgs.Commit = strings.TrimPrefix(arg, "--commit=")
-	} else if arg == "--help" || arg == "-h" {
-		globalArgs.Command = "help"
-		return true, nil
-	} else if arg == "--version" || arg == "-v" {
-		globalArgs.Command = "version"
-		return true, nil
-	} else {
-		return false, errors.New("Unknown global option: " + arg)
+// ParseArgs takes arguments and splits them into global and remaining args.
+func ParseArgs(args []string) (*GlobalArgs, []string, error) {
+	var globalArgs GlobalArgs
+	remainingArgs, err := NewGlobalArgParser(&globalArgs).Parse(args)
+	if err != nil {
+		return nil, []string{}, err
 	}
-	return false, nil
+	return &globalArgs, remainingArgs, nil
 }
 
-// ParseArgs takes arguments and splits them into global and remaining args.
-func ParseArgs(args []string) (*GlobalArgs, []string, error) {
+// FindCommand returns the command in args, even if the global options before it are invalid.
+func FindCommand(args []string) string {
 	var globalArgs GlobalArgs
-	remainingArgs := []string{}
-	i := 0
-	take := func() (string, error) {
-		i++
-		if i >= len(args) {
-			return "", errors.New("missing value")
-		}
+	return NewGlobalArgParser(&globalArgs).FirstArg(args)
+}
 
-		return args[i], nil
+// NewGlobalArgParser returns the parser for the global options, which sets globalArgs and stops at the command.
+func NewGlobalArgParser(globalArgs *GlobalArgs) *ArgParser {
+	return &ArgParser{
+		Name: "global",
+		Options: []Option{
+			Flag("no-pull-config", "", func() { globalArgs.NoPullConfig = true }),
+			Flag("no-pull-release", "", func() { globalArgs.NoPullRelease = true }),
+			Flag("no-pull-terraform", "", func() { globalArgs.NoPullTerraform = true }),
+			Flag("no-pull-scan", "", func() { globalArgs.NoPullScan = true }),
+			{Long: "quiet", Short: "q", NoDefault: true, Handle: func(string) error {
+				fmt.Fprintf(os.Stderr, "Quiet flag is deprecated, please remove from your command.\n")
+				return nil
+			}},
+			{Long: "config-param", TakesValue: true, Repeated: true, Handle: func(value string) error {
+				globalArgs.ConfigParams = append(globalArgs.ConfigParams, value)
+				return nil
+			}},
+			StringValue("component", "c", &globalArgs.Component),
+			StringValue("commit", "", &globalArgs.Commit),
+			Value("output", "", func(value string) error {
+				if value != OutputText && value != OutputJSON {
+					return errors.New("output must be text or json: " + value)
+				}
+				globalArgs.Output = value
+				return nil
+			}),
+			StringValue("result-file", "", &globalArgs.ResultFile),
+			{Long: "help", Short: "h", Stop: true, Handle: func(string) error {
+				globalArgs.Command = "help"
+				return nil
+			}},
+			{Long: "version", Short: "v", Stop: true, Handle: func(string) error {
+				globalArgs.Command = "version"
+				return nil
+			}},
+		},
+		HandleArg: func(arg string) (bool, error) {
+			globalArgs.Command = arg
+			return true, nil
+		},
 	}
-	for ; i < len(args); i++ {
-		done, err := handleArg(args[i], &globalArgs, take)
-		if err != nil {
-			return nil, remainingArgs, err
-		}
-		if done {
-			remainingArgs = args[i+1:]
-			break
-		}
-	}
-	return &globalArgs, remainingArgs, nil
 }
 
 // GetComponentFromGit gets the last part of the git repo name to use as a default component name.
@@ -136,6 +136,27 @@ func TestParseArgsVersion(t *testing.T) {
 	}
 }
 
+func TestFindCommand(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"deploy", "drift", "1"}, "deploy"},
+		{[]string{"--output", "yaml", "drift", "live", "1"}, "drift"},
+		{[]string{"--component=drift", "deploy"}, "deploy"},
+		{[]string{"-c", "drift", "deploy"}, "deploy"},
+		{[]string{"-cdrift", "deploy"}, "deploy"},
+		{[]string{"--unknown", "drift"}, "drift"},
+		{[]string{"--", "drift"}, "drift"},
+		{[]string{"--help", "drift"}, ""},
+		{[]string{"--no-pull-config"}, ""},
+	} {
+		if got := command.FindCommand(tc.args); got != tc.want {
+			t.Errorf("%v: got %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
 func TestGetComponentFromGit(t *testing.T) {
 	component, err := command.GetComponentFromGit()
 	if err != nil {
@@ -0,0 +1,114 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// UserDefaultsEnvVar can be set to the path of the user defaults file to use instead of the default location.
+const UserDefaultsEnvVar = "CDFLOW2_USER_CONFIG"
+
+// UserDefaults are option defaults from the per-user config file, keyed by the argument parser name ("global" or the
+// command name), then the long option name.
+type UserDefaults map[string]map[string][]string
+
+type userDefaultsFile struct {
+	Global   map[string]interface{}            `yaml:"global"`
+	Commands map[string]map[string]interface{} `yaml:"commands"`
+}
+
+// UserDefaultsPath returns the path of the user defaults file - $XDG_CONFIG_HOME/cdflow2/config.yaml, by default
+// ~/.config/cdflow2/config.yaml.
+func UserDefaultsPath() (string, error) {
+	if filename := os.Getenv(UserDefaultsEnvVar); filename != "" {
+		return filename, nil
+	}
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return path.Join(configHome, "cdflow2", "config.yaml"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(home, ".config", "cdflow2", "config.yaml"), nil
+}
+
+// LoadUserDefaults loads a user defaults file, returning no defaults if it doesn't exist.
+func LoadUserDefaults(filename string) (UserDefaults, error) {
+	data, err := ioutil.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return UserDefaults{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading %s: %w", filename, err)
+	}
+	var file userDefaultsFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", filename, err)
+	}
+	result := UserDefaults{}
+	sections := map[string]map[string]interface{}{"global": file.Global}
+	for name, options := range file.Commands {
+		sections[name] = options
+	}
+	for name, options := range sections {
+		result[name] = map[string][]string{}
+		for option, value := range options {
+			values, err := defaultValues(value)
+			if err != nil {
+				return nil, fmt.Errorf("error in %s, %s option %s: %w", filename, name, option, err)
+			}
+			result[name][option] = values
+		}
+	}
+	return result, nil
+}
+
+// defaultValues converts a value from the user defaults file into strings, as if it was passed on the command line.
+func defaultValues(value interface{}) ([]string, error) {
+	switch value := value.(type) {
+	case []interface{}:
+		var result []string
+		for _, item := range value {
+			values, err := defaultValues(item)
+			if err != nil {
+				return nil, err
+			}
+			if len(values) != 1 {
+				return nil, errors.New("lists can only contain single values")
+			}
+			result = append(result, values...)
+		}
+		return result, nil
+	case string, bool, int, float64:
+		return []string{fmt.Sprint(value)}, nil
+	}
+	return nil, fmt.Errorf("unsupported value: %v", value)
+}
+
+var userDefaults struct {
+	once     sync.Once
+	source   string
+	defaults UserDefaults
+	err      error
+}
+
+// GetUserDefaults returns the defaults from the user defaults file and its path, loading it the first time it's called.
+func GetUserDefaults() (UserDefaults, string, error) {
+	userDefaults.once.Do(func() {
+		filename, err := UserDefaultsPath()
+		if err != nil {
+			// without a home directory there's no user defaults file
+			userDefaults.defaults = UserDefaults{}
+			return
+		}
+		userDefaults.source = filename
+		userDefaults.defaults, userDefaults.err = LoadUserDefaults(filename)
+	})
+	return userDefaults.defaults, userDefaults.source, userDefaults.err
+}
@@ -0,0 +1,72 @@
+package command_test
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/command"
+)
+
+func TestLoadUserDefaults(t *testing.T) {
+	t.Run("missing file", func(t *testing.T) {
+		got, err := command.LoadUserDefaults(path.Join(t.TempDir(), "config.yaml"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 0 {
+			t.Errorf("expected no defaults, got %v", got)
+		}
+	})
+
+	t.Run("global and command defaults", func(t *testing.T) {
+		filename := path.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(filename, []byte(`
+global:
+  no-pull-release: true
+  config-param:
+    - team=platform
+    - owner=me
+commands:
+  rollback:
+    steps: 2
+    terraform-log-level: INFO
+`), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := command.LoadUserDefaults(filename)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := command.UserDefaults{
+			"global": {
+				"no-pull-release": {"true"},
+				"config-param":    {"team=platform", "owner=me"},
+			},
+			"rollback": {
+				"steps":               {"2"},
+				"terraform-log-level": {"INFO"},
+			},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	for name, content := range map[string]string{
+		"unknown section": "deploy:\n  force: true\n",
+		"nested value":    "global:\n  component:\n    name: foo\n",
+	} {
+		t.Run("sad path - "+name, func(t *testing.T) {
+			filename := path.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := command.LoadUserDefaults(filename); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is the prefix of the environment variables that options default to.
+const EnvPrefix = "CDFLOW2_"
+
+// Option is an option accepted by a command.
+type Option struct {
+	// Long is the name of the option without the leading "--", e.g. "terraform-log-level".
+	Long string
+	// Short is the single letter name of the option without the leading "-", or empty for none.
+	Short string
+	// TakesValue is true for options that are followed by a value.
+	TakesValue bool
+	// NoDefault stops the option defaulting to the value of an environment variable or the user defaults file.
+	NoDefault bool
+	// Repeated is true for options that can be given more than once, in which case the values from the user defaults
+	// file, environment and command line are all used (in that order), rather than the command line taking precedence.
+	Repeated bool
+	// Stop ends parsing after the option, leaving the remaining arguments unparsed.
+	Stop bool
+	// Handle is called with the value of the option (empty for options that don't take a value).
+	Handle func(value string) error
+}
+
+// Flag returns an option that doesn't take a value.
+func Flag(long, short string, handle func()) Option {
+	return Option{Long: long, Short: short, Handle: func(string) error {
+		handle()
+		return nil
+	}}
+}
+
+// Value returns an option that takes a value.
+func Value(long, short string, handle func(value string) error) Option {
+	return Option{Long: long, Short: short, TakesValue: true, Handle: handle}
+}
+
+// StringValue returns an option that sets a string.
+func StringValue(long, short string, target *string) Option {
+	return Value(long, short, func(value string) error {
+		*target = value
+		return nil
+	})
+}
+
+// CommandLineOnly returns option with NoDefault set, for options whose environment variable would be too generic (e.g.
+// CDFLOW2_VERSION) or whose value should always be visible on the command line.
+func CommandLineOnly(option Option) Option {
+	option.NoDefault = true
+	return option
+}
+
+// EnvName returns the environment variable that an option defaults to, e.g. CDFLOW2_TERRAFORM_LOG_LEVEL.
+func EnvName(long string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(long, "-", "_"))
+}
+
+// ArgParser parses the options and arguments to a command. Options that take a value can be given as "--name value",
+// "--name=value", "-n value" or "-nvalue", and short options can be combined (e.g. "-pf"). Unless NoDefault is set
+// each option defaults to the value of its environment variable (see EnvName), or failing that the value in the
+// user defaults file (see UserDefaultsPath), with the command line taking precedence over both.
+type ArgParser struct {
+	// Name is used in error messages, e.g. "deploy".
+	Name    string
+	Options []Option
+	// HandleArg is called with each positional argument, returning true to end parsing leaving the remaining
+	// arguments unparsed.
+	HandleArg func(arg string) (bool, error)
+	// HandleUnknownOption is called for long options that aren't in Options, with a function to take the value. If it
+	// is nil unknown options are an error.
+	HandleUnknownOption func(name string, take func() (string, error)) error
+	// StopAtDoubleDash makes "--" end parsing leaving the remaining arguments unparsed, rather than treating them as
+	// positional arguments.
+	StopAtDoubleDash bool
+	// LookupEnv looks up the environment variables options default to, os.LookupEnv if nil.
+	LookupEnv func(key string) (string, bool)
+	// Defaults are the values from the user defaults file keyed by long option name, or if nil they are loaded from
+	// the section of the user defaults file for Name.
+	Defaults map[string][]string
+	// DefaultsSource describes where Defaults came from when set.
+	DefaultsSource string
+	// Trace is called with the long name, value and source of each option as it is applied, if set.
+	Trace func(option, value, source string)
+}
+
+// SourceCommandLine is the source passed to Trace for options given on the command line.
+const SourceCommandLine = "command line"
+
+type sourcedValue struct {
+	value  string
+	source string
+}
+
+// Parse parses the arguments, returning those left unparsed.
+func (parser *ArgParser) Parse(args []string) ([]string, error) {
+	if err := parser.applyDefaults(); err != nil {
+		return nil, err
+	}
+
+	i := 0
+	take := func() (string, error) {
+		i++
+		if i >= len(args) {
+			return "", errors.New("missing value")
+		}
+
+		return args[i], nil
+	}
+	positionalOnly := false
+	for ; i < len(args); i++ {
+		arg := args[i]
+		var done bool
+		var err error
+		if !positionalOnly && arg == "--" {
+			if parser.StopAtDoubleDash {
+				return args[i+1:], nil
+			}
+			positionalOnly = true
+			continue
+		} else if !positionalOnly && strings.HasPrefix(arg, "--") {
+			done, err = parser.handleLong(arg, take)
+		} else if !positionalOnly && strings.HasPrefix(arg, "-") && arg != "-" {
+			done, err = parser.handleShort(arg, take)
+		} else if parser.HandleArg != nil {
+			done, err = parser.HandleArg(arg)
+		} else {
+			err = errors.New("unknown " + parser.Name + " argument: " + arg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			return args[i+1:], nil
+		}
+	}
+	return []string{}, nil
+}
+
+// FirstArg returns the first positional argument in args without applying any options, skipping the values of those
+// that take one, or "" if there is none before the end (or an option that stops parsing). This finds the command even
+// when Parse fails on an option before it.
+func (parser *ArgParser) FirstArg(args []string) string {
+	positionalOnly := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !positionalOnly && arg == "--" {
+			if parser.StopAtDoubleDash {
+				return ""
+			}
+			positionalOnly = true
+			continue
+		} else if !positionalOnly && strings.HasPrefix(arg, "--") {
+			name, _, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+			option := parser.find(func(option *Option) bool { return option.Long == name })
+			if option != nil && option.Stop {
+				return ""
+			}
+			if option != nil && option.TakesValue && !hasValue {
+				i++
+			}
+		} else if !positionalOnly && strings.HasPrefix(arg, "-") && arg != "-" {
+			letters := strings.TrimPrefix(arg, "-")
+			for j, letter := range letters {
+				option := parser.find(func(option *Option) bool { return option.Short == string(letter) })
+				if option != nil && option.Stop {
+					return ""
+				}
+				if option != nil && option.TakesValue {
+					if j+len(string(letter)) == len(letters) {
+						i++
+					}
+					break
+				}
+			}
+		} else {
+			return arg
+		}
+	}
+	return ""
+}
+
+func (parser *ArgParser) trace(option, value, source string) {
+	if parser.Trace != nil {
+		parser.Trace(option, value, source)
+	}
+}
+
+func (parser *ArgParser) applyDefaults() error {
+	defaults, defaultsSource := parser.Defaults, parser.DefaultsSource
+	if defaults == nil {
+		userDefaults, filename, err := GetUserDefaults()
+		if err != nil {
+			return err
+		}
+		defaults, defaultsSource = userDefaults[parser.Name], filename
+	}
+	lookupEnv := parser.LookupEnv
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+
+	for _, name := range sortedKeys(defaults) {
+		option := parser.find(func(option *Option) bool { return option.Long == name })
+		if option == nil && parser.HandleUnknownOption == nil {
+			return fmt.Errorf("unknown %s option in %s: %s", parser.Name, defaultsSource, name)
+		} else if option == nil {
+			for _, value := range defaults[name] {
+				value := value
+				if err := parser.HandleUnknownOption(name, func() (string, error) { return value, nil }); err != nil {
+					return fmt.Errorf("%s: %w", defaultsSource, err)
+				}
+				parser.trace(name, value, defaultsSource)
+			}
+		} else if option.NoDefault || option.Stop {
+			return fmt.Errorf("option %s in %s can only be given on the command line", name, defaultsSource)
+		}
+	}
+
+	for _, option := range parser.Options {
+		if option.NoDefault || option.Stop {
+			continue
+		}
+		var values []sourcedValue
+		for _, value := range defaults[option.Long] {
+			values = append(values, sourcedValue{value, defaultsSource})
+		}
+		envName := EnvName(option.Long)
+		if value, ok := lookupEnv(envName); ok && value != "" {
+			if !option.Repeated {
+				values = nil
+			}
+			values = append(values, sourcedValue{value, "environment variable " + envName})
+		}
+		if len(values) > 1 && !option.Repeated {
+			return fmt.Errorf("option %s in %s can only have one value", option.Long, defaultsSource)
+		}
+		for _, value := range values {
+			if err := parser.applyDefault(&option, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (parser *ArgParser) applyDefault(option *Option, value sourcedValue) error {
+	if !option.TakesValue {
+		set, err := strconv.ParseBool(value.value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s in %s (must be true or false): %s", option.Long, value.source, value.value)
+		}
+		if !set {
+			return nil
+		}
+		if err := option.Handle(""); err != nil {
+			return fmt.Errorf("%s: %w", value.source, err)
+		}
+		parser.trace(option.Long, "true", value.source)
+		return nil
+	}
+	if err := option.Handle(value.value); err != nil {
+		return fmt.Errorf("%s: %w", value.source, err)
+	}
+	parser.trace(option.Long, value.value, value.source)
+	return nil
+}
+
+func sortedKeys(values map[string][]string) []string {
+	var result []string
+	for key := range values {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (parser *ArgParser) find(match func(option *Option) bool) *Option {
+	for i := range parser.Options {
+		if match(&parser.Options[i]) {
+			return &parser.Options[i]
+		}
+	}
+	return nil
+}
+
+func (parser *ArgParser) handleLong(arg string, take func() (string, error)) (bool, error) {
+	name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+	if hasValue {
+		take = func() (string, error) {
+			return value, nil
+		}
+	}
+	option := parser.find(func(option *Option) bool { return option.Long == name })
+	if option == nil {
+		if parser.HandleUnknownOption != nil && name != "" {
+			return false, parser.HandleUnknownOption(name, func() (string, error) {
+				value, err := take()
+				parser.trace(name, value, SourceCommandLine)
+				return value, err
+			})
+		}
+		return false, errors.New("unknown " + parser.Name + " option: " + arg)
+	}
+	if !option.TakesValue {
+		if hasValue {
+			return false, errors.New("option --" + name + " does not take a value")
+		}
+		return option.Stop, parser.apply(option, "")
+	}
+	value, err := take()
+	if err != nil {
+		return false, err
+	}
+	return option.Stop, parser.apply(option, value)
+}
+
+func (parser *ArgParser) handleShort(arg string, take func() (string, error)) (bool, error) {
+	letters := strings.TrimPrefix(arg, "-")
+	for j, letter := range letters {
+		option := parser.find(func(option *Option) bool { return option.Short == string(letter) })
+		if option == nil {
+			return false, errors.New("unknown " + parser.Name + " option: -" + string(letter))
+		}
+		if !option.TakesValue {
+			if err := parser.apply(option, ""); err != nil {
+				return false, err
+			}
+			if option.Stop {
+				return true, nil
+			}
+			continue
+		}
+		// the rest of the argument is the value, or if there is none the next argument
+		value := letters[j+len(string(letter)):]
+		if value == "" {
+			var err error
+			if value, err = take(); err != nil {
+				return false, err
+			}
+		}
+		return option.Stop, parser.apply(option, value)
+	}
+	return false, nil
+}
+
+// apply applies an option given on the command line.
+func (parser *ArgParser) apply(option *Option, value string) error {
+	if err := option.Handle(value); err != nil {
+		return err
+	}
+	traceValue := value
+	if !option.TakesValue {
+		traceValue = "true"
+	}
+	parser.trace(option.Long, traceValue, SourceCommandLine)
+	return nil
+}
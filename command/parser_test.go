@@ -0,0 +1,171 @@
+package command_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/command"
+)
+
+type parsed struct {
+	PlanOnly  bool
+	Force     bool
+	LogLevel  string
+	Args      []string
+	Remaining []string
+}
+
+func parse(args []string, env map[string]string, defaults map[string][]string) (*parsed, error) {
+	var result parsed
+	parser := command.ArgParser{
+		Name: "test",
+		Options: []command.Option{
+			command.Flag("plan-only", "p", func() { result.PlanOnly = true }),
+			command.Flag("force", "f", func() { result.Force = true }),
+			command.StringValue("terraform-log-level", "t", &result.LogLevel),
+		},
+		HandleArg: func(arg string) (bool, error) {
+			result.Args = append(result.Args, arg)
+			return false, nil
+		},
+		LookupEnv: func(key string) (string, bool) {
+			value, ok := env[key]
+			return value, ok
+		},
+		Defaults:       defaults,
+		DefaultsSource: "config.yaml",
+	}
+	if parser.Defaults == nil {
+		parser.Defaults = map[string][]string{}
+	}
+	remaining, err := parser.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	result.Remaining = remaining
+	return &result, nil
+}
+
+func TestArgParser(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args     []string
+		env      map[string]string
+		defaults map[string][]string
+		want     parsed
+	}{
+		"long options": {
+			args: []string{"--plan-only", "live", "--terraform-log-level", "DEBUG", "1"},
+			want: parsed{PlanOnly: true, LogLevel: "DEBUG", Args: []string{"live", "1"}},
+		},
+		"long option with equals": {
+			args: []string{"live", "--terraform-log-level=DEBUG"},
+			want: parsed{LogLevel: "DEBUG", Args: []string{"live"}},
+		},
+		"short options": {
+			args: []string{"-p", "-t", "DEBUG", "live"},
+			want: parsed{PlanOnly: true, LogLevel: "DEBUG", Args: []string{"live"}},
+		},
+		"combined short options": {
+			args: []string{"-pf", "live"},
+			want: parsed{PlanOnly: true, Force: true, Args: []string{"live"}},
+		},
+		"combined short options ending with a value": {
+			args: []string{"-pft", "DEBUG", "live"},
+			want: parsed{PlanOnly: true, Force: true, LogLevel: "DEBUG", Args: []string{"live"}},
+		},
+		"short option with attached value": {
+			args: []string{"-tDEBUG", "live"},
+			want: parsed{LogLevel: "DEBUG", Args: []string{"live"}},
+		},
+		"double dash": {
+			args: []string{"live", "--", "-p"},
+			want: parsed{Args: []string{"live", "-p"}},
+		},
+		"environment defaults": {
+			args: []string{"live"},
+			env:  map[string]string{"CDFLOW2_TERRAFORM_LOG_LEVEL": "INFO", "CDFLOW2_PLAN_ONLY": "true", "CDFLOW2_FORCE": "false"},
+			want: parsed{PlanOnly: true, LogLevel: "INFO", Args: []string{"live"}},
+		},
+		"command line overrides environment": {
+			args: []string{"-t", "DEBUG", "live"},
+			env:  map[string]string{"CDFLOW2_TERRAFORM_LOG_LEVEL": "INFO"},
+			want: parsed{LogLevel: "DEBUG", Args: []string{"live"}},
+		},
+		"user defaults": {
+			args:     []string{"live"},
+			defaults: map[string][]string{"terraform-log-level": {"WARN"}, "force": {"true"}},
+			want:     parsed{Force: true, LogLevel: "WARN", Args: []string{"live"}},
+		},
+		"environment overrides user defaults": {
+			args:     []string{"live"},
+			env:      map[string]string{"CDFLOW2_TERRAFORM_LOG_LEVEL": "INFO", "CDFLOW2_FORCE": "false"},
+			defaults: map[string][]string{"terraform-log-level": {"WARN"}, "force": {"true"}},
+			want:     parsed{LogLevel: "INFO", Args: []string{"live"}},
+		},
+		"command line overrides user defaults": {
+			args:     []string{"live", "-t", "DEBUG"},
+			defaults: map[string][]string{"terraform-log-level": {"WARN"}},
+			want:     parsed{LogLevel: "DEBUG", Args: []string{"live"}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := parse(tc.args, tc.env, tc.defaults)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tc.want.Remaining = []string{}
+			if !reflect.DeepEqual(*got, tc.want) {
+				t.Errorf("got %+v, want %+v", *got, tc.want)
+			}
+		})
+	}
+
+	for name, tc := range map[string]struct {
+		args     []string
+		env      map[string]string
+		defaults map[string][]string
+	}{
+		"unknown long option":           {args: []string{"--foo"}},
+		"unknown short option":          {args: []string{"-px"}},
+		"missing value":                 {args: []string{"live", "-t"}},
+		"value for flag":                {args: []string{"--force=yes"}},
+		"invalid environment flag":      {env: map[string]string{"CDFLOW2_FORCE": "yes"}},
+		"unknown user default":          {defaults: map[string][]string{"foo": {"bar"}}},
+		"multiple values for an option": {defaults: map[string][]string{"terraform-log-level": {"INFO", "WARN"}}},
+	} {
+		t.Run("sad path - "+name, func(t *testing.T) {
+			if _, err := parse(tc.args, tc.env, tc.defaults); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestArgParserStop(t *testing.T) {
+	var envName string
+	parser := command.ArgParser{
+		Name: "test",
+		HandleArg: func(arg string) (bool, error) {
+			envName = arg
+			return false, nil
+		},
+		StopAtDoubleDash: true,
+		Defaults:         map[string][]string{},
+	}
+	remaining, err := parser.Parse([]string{"live", "--", "terraform", "-help"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if envName != "live" {
+		t.Errorf("got env %q, want live", envName)
+	}
+	if want := []string{"terraform", "-help"}; !reflect.DeepEqual(remaining, want) {
+		t.Errorf("got %v, want %v", remaining, want)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	if got := command.EnvName("terraform-log-level"); got != "CDFLOW2_TERRAFORM_LOG_LEVEL" {
+		t.Errorf("got %s", got)
+	}
+}
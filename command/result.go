@@ -0,0 +1,137 @@
+package command
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// ResultSuccess is the status of a command that succeeded.
+	ResultSuccess = "success"
+	// ResultFailure is the status of a command that failed.
+	ResultFailure = "failure"
+)
+
+// Phase is a timed part of a command. Phases that are not completed are those that were running when the command
+// failed.
+type Phase struct {
+	Name            string  `json:"name"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Completed       bool    `json:"completed"`
+
+	start time.Time
+}
+
+// PlanCounts are the number of resources a terraform plan would change.
+type PlanCounts struct {
+	Add     int `json:"add"`
+	Change  int `json:"change"`
+	Destroy int `json:"destroy"`
+}
+
+// Result is the machine readable summary of a command, written for the --output json and --result-file global options.
+// The methods do nothing on a nil Result, so commands can record their progress without checking if one was asked for.
+type Result struct {
+	Command         string                       `json:"command"`
+	Component       string                       `json:"component"`
+	Version         string                       `json:"version,omitempty"`
+	Environment     string                       `json:"environment,omitempty"`
+	Status          string                       `json:"status"`
+	Error           string                       `json:"error,omitempty"`
+	DurationSeconds float64                      `json:"duration_seconds"`
+	Phases          []*Phase                     `json:"phases"`
+	Plan            *PlanCounts                  `json:"plan,omitempty"`
+	ReleaseMetadata map[string]map[string]string `json:"release_metadata,omitempty"`
+	UploadMessage   string                       `json:"upload_message,omitempty"`
+
+	start time.Time
+	// phases can be recorded concurrently (e.g. the terraform part of a release)
+	mutex sync.Mutex
+}
+
+// NewResult returns a result for a command that is starting now.
+func NewResult(command, component string) *Result {
+	return &Result{Command: command, Component: component, Phases: []*Phase{}, start: time.Now()}
+}
+
+// SetVersion records the version the command is for.
+func (result *Result) SetVersion(version string) {
+	if result == nil {
+		return
+	}
+	result.Version = version
+}
+
+// SetEnvironment records the environment the command is for.
+func (result *Result) SetEnvironment(envName string) {
+	if result == nil {
+		return
+	}
+	result.Environment = envName
+}
+
+// StartPhase records the start of a phase of the command, returning a function to call at the end of it.
+func (result *Result) StartPhase(name string) func() {
+	if result == nil {
+		return func() {}
+	}
+	phase := &Phase{Name: name, start: time.Now()}
+	result.mutex.Lock()
+	defer result.mutex.Unlock()
+	result.Phases = append(result.Phases, phase)
+	return func() {
+		result.mutex.Lock()
+		defer result.mutex.Unlock()
+		phase.DurationSeconds = time.Since(phase.start).Seconds()
+		phase.Completed = true
+	}
+}
+
+// SetPlan records the number of resources the terraform plan would change.
+func (result *Result) SetPlan(add, change, destroy int) {
+	if result == nil {
+		return
+	}
+	result.Plan = &PlanCounts{Add: add, Change: change, Destroy: destroy}
+}
+
+// SetRelease records the metadata of a release and the message from uploading it.
+func (result *Result) SetRelease(metadata map[string]map[string]string, uploadMessage string) {
+	if result == nil {
+		return
+	}
+	result.ReleaseMetadata = metadata
+	result.UploadMessage = uploadMessage
+}
+
+// Finish records the outcome of the command - err is nil if it succeeded.
+func (result *Result) Finish(err error) {
+	if result == nil {
+		return
+	}
+	result.mutex.Lock()
+	defer result.mutex.Unlock()
+	result.DurationSeconds = time.Since(result.start).Seconds()
+	for _, phase := range result.Phases {
+		if !phase.Completed {
+			phase.DurationSeconds = time.Since(phase.start).Seconds()
+		}
+	}
+	if err == nil {
+		result.Status = ResultSuccess
+		return
+	}
+	result.Status = ResultFailure
+	result.Error = err.Error()
+}
+
+// Write writes the result as JSON.
+func (result *Result) Write(outputStream io.Writer) error {
+	result.mutex.Lock()
+	defer result.mutex.Unlock()
+	encoder := json.NewEncoder(outputStream)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
@@ -0,0 +1,73 @@
+package command_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/command"
+)
+
+func TestResult(t *testing.T) {
+	result := command.NewResult("deploy", "my-component")
+	result.SetEnvironment("live")
+	result.SetVersion("1")
+	result.StartPhase("plan")()
+	result.StartPhase("apply")
+	result.SetPlan(1, 2, 3)
+	result.Finish(errors.New("apply failed"))
+
+	var output bytes.Buffer
+	if err := result.Write(&output); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(output.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, output.String())
+	}
+
+	for key, want := range map[string]interface{}{
+		"command":     "deploy",
+		"component":   "my-component",
+		"environment": "live",
+		"version":     "1",
+		"status":      command.ResultFailure,
+		"error":       "apply failed",
+	} {
+		if got[key] != want {
+			t.Errorf("got %s %v, want %v", key, got[key], want)
+		}
+	}
+	phases := got["phases"].([]interface{})
+	if len(phases) != 2 {
+		t.Fatalf("expected 2 phases, got %v", phases)
+	}
+	for i, want := range []struct {
+		name      string
+		completed bool
+	}{{"plan", true}, {"apply", false}} {
+		phase := phases[i].(map[string]interface{})
+		if phase["name"] != want.name || phase["completed"] != want.completed {
+			t.Errorf("got phase %v, want %+v", phase, want)
+		}
+	}
+	plan := got["plan"].(map[string]interface{})
+	if plan["add"] != 1.0 || plan["change"] != 2.0 || plan["destroy"] != 3.0 {
+		t.Errorf("unexpected plan: %v", plan)
+	}
+	if _, ok := got["release_metadata"]; ok {
+		t.Error("expected release_metadata to be omitted")
+	}
+}
+
+func TestNilResult(t *testing.T) {
+	// commands record their progress without checking whether a result was asked for
+	var result *command.Result
+	result.SetVersion("1")
+	result.SetEnvironment("live")
+	result.StartPhase("plan")()
+	result.SetPlan(1, 0, 0)
+	result.SetRelease(nil, "")
+	result.Finish(nil)
+}
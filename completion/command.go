@@ -0,0 +1,192 @@
+package completion
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mergermarket/cdflow2/manifest"
+)
+
+// Flag is an option to a command.
+type Flag struct {
+	Long       string
+	Short      string
+	TakesValue bool
+	// Repeated is true for options that can be given more than once.
+	Repeated bool
+}
+
+// Command describes a command for completion.
+type Command struct {
+	Name        string
+	Description string
+	Flags       []Flag
+	// EnvArg is true when the first argument is the name of an environment.
+	EnvArg bool
+	// CommandArg is true when the first argument is the name of a command.
+	CommandArg bool
+	// Args are the possible values of the first argument.
+	Args []string
+}
+
+// GlobalFlags are the options accepted before the command.
+var GlobalFlags = []Flag{
+	{Long: "--component", Short: "-c", TakesValue: true},
+	{Long: "--commit", TakesValue: true},
+	{Long: "--config-param", TakesValue: true, Repeated: true},
+	{Long: "--no-pull-config"},
+	{Long: "--no-pull-release"},
+	{Long: "--no-pull-terraform"},
+	{Long: "--no-pull-scan"},
+	{Long: "--output", TakesValue: true},
+	{Long: "--result-file", TakesValue: true},
+	{Long: "--quiet", Short: "-q"},
+	{Long: "--version", Short: "-v"},
+	{Long: "--help", Short: "-h"},
+}
+
+var terraformLogLevel = Flag{Long: "--terraform-log-level", Short: "-t", TakesValue: true}
+
+// Commands are the commands handled in main.go, so need updating along with it.
+var Commands = []Command{
+	{Name: "setup", Description: "configure your pipeline"},
+	{Name: "init", Description: "initialize a new project", Flags: []Flag{
+		{Long: "--name", Short: "-n", TakesValue: true},
+		{Long: "--boilerplate", Short: "-b", TakesValue: true},
+	}},
+	{Name: "release", Description: "build and publish a new software artifact", Flags: []Flag{
+		{Long: "--release-data", Short: "-r", TakesValue: true, Repeated: true},
+		terraformLogLevel,
+		{Long: "--dry-run", Short: "-n"},
+		{Long: "--export-dir", Short: "-e", TakesValue: true},
+		{Long: "--only", TakesValue: true, Repeated: true},
+		{Long: "--skip", TakesValue: true, Repeated: true},
+		{Long: "--no-partial-upload"},
+		{Long: "--parallelism", Short: "-p", TakesValue: true},
+	}},
+	{Name: "releases", Description: "list stored releases or show the details of one", Args: []string{"list", "show"}},
+	{Name: "diff", Description: "compare two releases"},
+	{Name: "deploy", Description: "create & update infrastructure using software artifact", EnvArg: true, Flags: []Flag{
+		{Long: "--plan-only", Short: "-p"},
+		{Long: "--refresh-only", Short: "-r"},
+		{Long: "--new-state", Short: "-n"},
+		{Long: "--error-on-destroy", Short: "-e"},
+		{Long: "--force", Short: "-f"},
+		{Long: "--accept-findings"},
+		terraformLogLevel,
+	}},
+	{Name: "rollback", Description: "redeploy the previously deployed version", EnvArg: true, Flags: []Flag{
+		{Long: "--steps", Short: "-s", TakesValue: true},
+		{Long: "--plan-only", Short: "-p"},
+		{Long: "--force", Short: "-f"},
+		{Long: "--accept-findings"},
+		terraformLogLevel,
+	}},
+	{Name: "drift", Description: "check whether an environment has drifted from a release", EnvArg: true, Flags: []Flag{
+		terraformLogLevel,
+	}},
+	{Name: "destroy", Description: "destroy all Terraform managed infrastructure", EnvArg: true, Flags: []Flag{
+		{Long: "--plan-only", Short: "-p"},
+		{Long: "--force", Short: "-f"},
+		terraformLogLevel,
+	}},
+	{Name: "lock", Description: "stop deploys to and destroys of an environment", EnvArg: true, Flags: []Flag{
+		{Long: "--reason", Short: "-r", TakesValue: true},
+	}},
+	{Name: "unlock", Description: "remove the lock on an environment", EnvArg: true},
+	{Name: "shell", Description: "access terraform for debugging and tf state manipulation", EnvArg: true, Flags: []Flag{
+		{Long: "--version", Short: "-v", TakesValue: true},
+		terraformLogLevel,
+	}},
+	{Name: "output", Description: "print the terraform outputs as JSON", EnvArg: true, Flags: []Flag{
+		{Long: "--raw", Short: "-r"},
+		{Long: "--version", Short: "-v", TakesValue: true},
+		terraformLogLevel,
+	}},
+	{Name: "validate", Description: "check cdflow.yaml, config files and infra"},
+	{Name: "clean", Description: "remove containers and volumes left behind by cdflow2", Flags: []Flag{
+		{Long: "--older-than", Short: "-o", TakesValue: true},
+		{Long: "--dry-run", Short: "-n"},
+		{Long: "--all-hosts", Short: "-a"},
+	}},
+	{Name: "doctor", Description: "check your environment is set up to run cdflow2"},
+	{Name: "config", Description: "show the options set by the user defaults file or environment", Args: []string{"show"}},
+	{Name: "completion", Description: "print a shell completion script", Args: shells},
+	{Name: "help", Description: "display help for a command", CommandArg: true},
+}
+
+var shells = []string{"bash", "zsh", "fish"}
+
+// CommandArgs contains specific arguments to the completion command.
+type CommandArgs struct {
+	Shell string
+	// Envs is set for `completion envs`, which the completion scripts use to list environments.
+	Envs bool
+}
+
+// ParseArgs parses command line arguments to the completion subcommand.
+func ParseArgs(args []string) (*CommandArgs, error) {
+	if len(args) != 1 {
+		return nil, errors.New("shell argument is missing (one of " + strings.Join(shells, ", ") + ")")
+	}
+	if args[0] == "envs" {
+		return &CommandArgs{Envs: true}, nil
+	}
+	for _, shell := range shells {
+		if args[0] == shell {
+			return &CommandArgs{Shell: shell}, nil
+		}
+	}
+	return nil, errors.New("unsupported shell: " + args[0])
+}
+
+// EnvNames returns the environments that have a config file in the config_files_folder of the project in codeDir.
+func EnvNames(codeDir string) ([]string, error) {
+	loadedManifest, err := manifest.Load(codeDir)
+	if err != nil {
+		return nil, err
+	}
+	configFilesFolder := loadedManifest.ConfigFilesFolder
+	if configFilesFolder == "" {
+		configFilesFolder = "config/"
+	}
+	filenames, err := filepath.Glob(path.Join(codeDir, configFilesFolder, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, filename := range filenames {
+		name := strings.TrimSuffix(path.Base(filename), ".json")
+		if name != "common" {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// RunCommand runs the completion command.
+func RunCommand(outputStream io.Writer, codeDir string, args *CommandArgs) error {
+	if args.Envs {
+		// errors are ignored as there's nothing useful to do with them while completing
+		envNames, _ := EnvNames(codeDir)
+		for _, name := range envNames {
+			fmt.Fprintln(outputStream, name)
+		}
+		return nil
+	}
+	switch args.Shell {
+	case "bash":
+		WriteBash(outputStream, Commands)
+	case "zsh":
+		WriteZsh(outputStream, Commands)
+	case "fish":
+		WriteFish(outputStream, Commands)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package completion_test
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/completion"
+)
+
+func TestParseArgs(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args []string
+		want completion.CommandArgs
+	}{
+		"bash": {[]string{"bash"}, completion.CommandArgs{Shell: "bash"}},
+		"zsh":  {[]string{"zsh"}, completion.CommandArgs{Shell: "zsh"}},
+		"fish": {[]string{"fish"}, completion.CommandArgs{Shell: "fish"}},
+		"envs": {[]string{"envs"}, completion.CommandArgs{Envs: true}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := completion.ParseArgs(tc.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *got != tc.want {
+				t.Errorf("got %+v, want %+v", *got, tc.want)
+			}
+		})
+	}
+
+	for name, args := range map[string][]string{
+		"no shell":          {},
+		"unsupported shell": {"powershell"},
+		"too many args":     {"bash", "zsh"},
+	} {
+		t.Run("sad path - "+name, func(t *testing.T) {
+			if _, err := completion.ParseArgs(args); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, filename, content string) {
+	if err := os.MkdirAll(path.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnvNames(t *testing.T) {
+	t.Run("default config folder", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, path.Join(dir, "cdflow.yaml"), "version: 2\n")
+		for _, name := range []string{"live", "common", "aslive"} {
+			writeFile(t, path.Join(dir, "config", name+".json"), "{}")
+		}
+		writeFile(t, path.Join(dir, "config", "README.md"), "")
+
+		got, err := completion.EnvNames(dir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := []string{"aslive", "live"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("config_files_folder", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, path.Join(dir, "cdflow.yaml"), "version: 2\nconfig_files_folder: envs/\n")
+		writeFile(t, path.Join(dir, "config", "live.json"), "{}")
+		writeFile(t, path.Join(dir, "envs", "ci.json"), "{}")
+
+		got, err := completion.EnvNames(dir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := []string{"ci"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("no cdflow.yaml", func(t *testing.T) {
+		if _, err := completion.EnvNames(t.TempDir()); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestScripts(t *testing.T) {
+	for shell, write := range map[string]func(*bytes.Buffer){
+		"bash": func(b *bytes.Buffer) { completion.WriteBash(b, completion.Commands) },
+		"zsh":  func(b *bytes.Buffer) { completion.WriteZsh(b, completion.Commands) },
+		"fish": func(b *bytes.Buffer) { completion.WriteFish(b, completion.Commands) },
+	} {
+		t.Run(shell, func(t *testing.T) {
+			var output bytes.Buffer
+			write(&output)
+			script := output.String()
+			for _, want := range []string{"deploy", "plan-only", "terraform-log-level", "component", "cdflow2 completion envs"} {
+				if !strings.Contains(script, want) {
+					t.Errorf("expected %s script to contain %q", shell, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package completion
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// envsCommand lists the environments of the project in the current directory while completing.
+const envsCommand = "cdflow2 completion envs 2>/dev/null"
+
+func flagWords(flags []Flag, valuesOnly bool) []string {
+	var result []string
+	for _, flag := range flags {
+		if valuesOnly && !flag.TakesValue {
+			continue
+		}
+		result = append(result, flag.Long)
+		if flag.Short != "" {
+			result = append(result, flag.Short)
+		}
+	}
+	return result
+}
+
+func commandNames(commands []Command) []string {
+	var result []string
+	for _, command := range commands {
+		result = append(result, command.Name)
+	}
+	return result
+}
+
+// argWords returns the fixed values of the first argument of a command.
+func argWords(command Command, commands []Command) []string {
+	if command.CommandArg {
+		return commandNames(commands)
+	}
+	return command.Args
+}
+
+// writeShellFunctions writes the functions describing the commands that are shared by the bash and zsh scripts. Each
+// takes the command name, or an empty string for the global options and command name.
+func writeShellFunctions(w io.Writer, commands []Command) {
+	fmt.Fprintln(w, "_cdflow2_flags() {")
+	fmt.Fprintln(w, "    case \"$1\" in")
+	fmt.Fprintf(w, "        \"\") echo \"%s\" ;;\n", strings.Join(flagWords(GlobalFlags, false), " "))
+	for _, command := range commands {
+		if len(command.Flags) > 0 {
+			fmt.Fprintf(w, "        %s) echo \"%s\" ;;\n", command.Name, strings.Join(flagWords(command.Flags, false), " "))
+		}
+	}
+	fmt.Fprintln(w, "    esac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "_cdflow2_value_flags() {")
+	fmt.Fprintln(w, "    case \"$1\" in")
+	fmt.Fprintf(w, "        \"\") echo \"%s\" ;;\n", strings.Join(flagWords(GlobalFlags, true), " "))
+	for _, command := range commands {
+		if words := flagWords(command.Flags, true); len(words) > 0 {
+			fmt.Fprintf(w, "        %s) echo \"%s\" ;;\n", command.Name, strings.Join(words, " "))
+		}
+	}
+	fmt.Fprintln(w, "    esac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "_cdflow2_args() {")
+	fmt.Fprintln(w, "    case \"$1\" in")
+	fmt.Fprintf(w, "        \"\") echo \"%s\" ;;\n", strings.Join(commandNames(commands), " "))
+	var envCommands []string
+	for _, command := range commands {
+		if command.EnvArg {
+			envCommands = append(envCommands, command.Name)
+		} else if words := argWords(command, commands); len(words) > 0 {
+			fmt.Fprintf(w, "        %s) echo \"%s\" ;;\n", command.Name, strings.Join(words, " "))
+		}
+	}
+	if len(envCommands) > 0 {
+		fmt.Fprintf(w, "        %s) %s ;;\n", strings.Join(envCommands, "|"), envsCommand)
+	}
+	fmt.Fprintln(w, "    esac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w)
+}
+
+// shellParseWords is the loop shared by the bash and zsh scripts that finds the command and the number of arguments
+// to it before the word being completed, skipping options and their values.
+const shellParseWords = `        word="${words[i]}"
+        if [[ $skip == 1 ]]; then
+            skip=0
+            continue
+        fi
+        if [[ "$word" == -* ]]; then
+            if [[ " $(_cdflow2_value_flags "$command") " == *" $word "* ]]; then
+                skip=1
+            fi
+            continue
+        fi
+        if [[ -z "$command" ]]; then
+            command="$word"
+        else
+            positional=$((positional + 1))
+        fi
+    done
+`
+
+// WriteBash writes a bash completion script for the commands.
+func WriteBash(w io.Writer, commands []Command) {
+	fmt.Fprintln(w, "# bash completion for cdflow2, load with: source <(cdflow2 completion bash)")
+	fmt.Fprintln(w)
+	writeShellFunctions(w, commands)
+	fmt.Fprint(w, `_cdflow2() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" command="" positional=0 skip=0 word i
+    local -a words=("${COMP_WORDS[@]}")
+    COMPREPLY=()
+    for ((i = 1; i < COMP_CWORD; i++)); do
+`+shellParseWords+`    if [[ $skip == 1 ]]; then
+        return
+    fi
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "$(_cdflow2_flags "$command")" -- "$cur"))
+    elif [[ $positional == 0 ]]; then
+        COMPREPLY=($(compgen -W "$(_cdflow2_args "$command")" -- "$cur"))
+    fi
+}
+
+complete -F _cdflow2 cdflow2
+`)
+}
+
+// WriteZsh writes a zsh completion script for the commands.
+func WriteZsh(w io.Writer, commands []Command) {
+	fmt.Fprintln(w, "#compdef cdflow2")
+	fmt.Fprintln(w, "# zsh completion for cdflow2, load with: source <(cdflow2 completion zsh)")
+	fmt.Fprintln(w)
+	writeShellFunctions(w, commands)
+	fmt.Fprint(w, `_cdflow2() {
+    local cur="${words[CURRENT]}" command="" positional=0 skip=0 word i
+    for ((i = 2; i < CURRENT; i++)); do
+`+shellParseWords+`    if [[ $skip == 1 ]]; then
+        return 1
+    fi
+    if [[ "$cur" == -* ]]; then
+        compadd -- ${=$(_cdflow2_flags "$command")}
+    elif [[ $positional == 0 ]]; then
+        compadd -- ${=$(_cdflow2_args "$command")}
+    fi
+}
+
+if [[ "$funcstack[1]" == "_cdflow2" ]]; then
+    _cdflow2 "$@"
+else
+    compdef _cdflow2 cdflow2
+fi
+`)
+}
+
+// fishQuote quotes a string for fish.
+func fishQuote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+func writeFishFlags(w io.Writer, condition string, flags []Flag) {
+	for _, flag := range flags {
+		line := "complete -c cdflow2 -n " + fishQuote(condition) + " -l " + strings.TrimPrefix(flag.Long, "--")
+		if flag.Short != "" {
+			line += " -s " + strings.TrimPrefix(flag.Short, "-")
+		}
+		if flag.TakesValue {
+			line += " -r"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// WriteFish writes a fish completion script for the commands.
+func WriteFish(w io.Writer, commands []Command) {
+	fmt.Fprintln(w, "# fish completion for cdflow2, load with: cdflow2 completion fish | source")
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "function __cdflow2_value_flags")
+	fmt.Fprintln(w, "    switch \"$argv[1]\"")
+	fmt.Fprintln(w, "        case ''")
+	fmt.Fprintf(w, "            string split ' ' -- %s\n", fishQuote(strings.Join(flagWords(GlobalFlags, true), " ")))
+	for _, command := range commands {
+		if words := flagWords(command.Flags, true); len(words) > 0 {
+			fmt.Fprintf(w, "        case %s\n", command.Name)
+			fmt.Fprintf(w, "            string split ' ' -- %s\n", fishQuote(strings.Join(words, " ")))
+		}
+	}
+	fmt.Fprintln(w, "    end")
+	fmt.Fprintln(w, "end")
+	fmt.Fprintln(w)
+
+	fmt.Fprint(w, `# prints the number of arguments to the command, whether the next word is the value of an option, and the command
+function __cdflow2_state
+    set -l tokens (commandline -opc)
+    set -e tokens[1]
+    set -l command ''
+    set -l positional 0
+    set -l skip 0
+    for token in $tokens
+        if test $skip = 1
+            set skip 0
+            continue
+        end
+        if string match -q -- '-*' $token
+            if contains -- $token (__cdflow2_value_flags $command)
+                set skip 1
+            end
+            continue
+        end
+        if test -z "$command"
+            set command $token
+        else
+            set positional (math $positional + 1)
+        end
+    end
+    echo "$positional $skip $command"
+end
+
+# true when completing options to the command (empty for global options)
+function __cdflow2_in
+    set -l state (string split ' ' -- (__cdflow2_state))
+    test "$state[3]" = "$argv[1]"
+end
+
+# true when completing the first argument to the command (empty for the command name)
+function __cdflow2_needs_arg
+    set -l state (string split ' ' -- (__cdflow2_state))
+    test "$state[3]" = "$argv[1]"; and test "$state[1]" = 0; and test "$state[2]" = 0
+end
+
+complete -c cdflow2 -f
+`)
+	writeFishFlags(w, "__cdflow2_in ''", GlobalFlags)
+	for _, command := range commands {
+		fmt.Fprintf(w, "complete -c cdflow2 -n %s -a %s -d %s\n",
+			fishQuote("__cdflow2_needs_arg ''"), command.Name, fishQuote(command.Description))
+	}
+	for _, command := range commands {
+		writeFishFlags(w, "__cdflow2_in "+command.Name, command.Flags)
+		condition := fishQuote("__cdflow2_needs_arg " + command.Name)
+		if command.EnvArg {
+			fmt.Fprintf(w, "complete -c cdflow2 -n %s -a %s\n", condition, fishQuote("("+envsCommand+")"))
+		} else if words := argWords(command, commands); len(words) > 0 {
+			fmt.Fprintf(w, "complete -c cdflow2 -n %s -a %s\n", condition, fishQuote(strings.Join(words, " ")))
+		}
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"archive/tar"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,17 +15,34 @@ import (
 	"github.com/mergermarket/cdflow2/util"
 )
 
+// LabelActions is the label on a config image listing the optional actions its config container supports, separated
+// by commas. Config containers exit on actions they don't know, so optional actions are only sent when declared.
+const LabelActions = "com.mergermarket.cdflow2.config.actions"
+
+// UnsupportedActionError is returned when the config image doesn't declare support for an optional action.
+type UnsupportedActionError struct {
+	Action string
+}
+
+func (unsupportedActionError *UnsupportedActionError) Error() string {
+	return fmt.Sprintf("config container does not support %s (it isn't listed in the %s label of the config image)", unsupportedActionError.Action, LabelActions)
+}
+
 // Container represents a config container.
 type Container struct {
+	ctx          context.Context
 	dockerClient docker.Iface
+	image        string
+	actions      map[string]bool
 	id           string
 	done         chan error
 	finished     bool
 	errorStream  io.Writer
 }
 
-// NewContainer creates and returns a new config container.
-func NewContainer(state *command.GlobalState, image, releaseVolume string) (*Container, error) {
+// NewContainer creates and returns a new config container. Requests are cancelled with ctx, but the container itself
+// keeps running until Done is called.
+func NewContainer(ctx context.Context, state *command.GlobalState, image, releaseVolume string) (*Container, error) {
 	dockerClient := state.DockerClient
 
 	cacheVolume, err := util.GetCacheVolume(dockerClient)
@@ -38,7 +56,9 @@ func NewContainer(state *command.GlobalState, image, releaseVolume string) (*Con
 	done := make(chan error, 1)
 
 	container := &Container{
+		ctx:          ctx,
 		dockerClient: dockerClient,
+		image:        image,
 		done:         done,
 		errorStream:  state.ErrorStream,
 	}
@@ -60,7 +80,7 @@ func NewContainer(state *command.GlobalState, image, releaseVolume string) (*Con
 				cacheVolume + ":/cache",
 			}
 		}
-		err := dockerClient.Run(&options)
+		err := dockerClient.Run(context.WithoutCancel(ctx), &options)
 		container.finished = true
 		done <- err
 	}()
@@ -81,7 +101,7 @@ func (configContainer *Container) request(request interface{}, response interfac
 	}
 	var errors bytes.Buffer
 	var rawResponse bytes.Buffer
-	if err := configContainer.dockerClient.Exec(&docker.ExecOptions{
+	if err := configContainer.dockerClient.Exec(configContainer.ctx, &docker.ExecOptions{
 		ID:           configContainer.id,
 		Cmd:          []string{"/app", "forward"},
 		InputStream:  &rawRequest,
@@ -99,6 +119,32 @@ func (configContainer *Container) request(request interface{}, response interfac
 	return nil
 }
 
+// SupportedActions returns the optional actions declared in the labels of a config image.
+func SupportedActions(labels map[string]string) map[string]bool {
+	result := make(map[string]bool)
+	for _, action := range strings.Split(labels[LabelActions], ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			result[action] = true
+		}
+	}
+	return result
+}
+
+// checkSupported returns an UnsupportedActionError if the config image doesn't declare an optional action.
+func (configContainer *Container) checkSupported(action string) error {
+	if configContainer.actions == nil {
+		labels, err := configContainer.dockerClient.GetImageLabels(configContainer.image)
+		if err != nil {
+			return err
+		}
+		configContainer.actions = SupportedActions(labels)
+	}
+	if !configContainer.actions[action] {
+		return &UnsupportedActionError{Action: action}
+	}
+	return nil
+}
+
 type Monitoring struct {
 	APIKey string
 	Data   map[string]string
@@ -231,6 +277,27 @@ func (configContainer *Container) CopyFileToRelease(filename string, content []b
 	return nil
 }
 
+// ExportRelease copies the contents of the release volume to a local directory via the config container.
+func (configContainer *Container) ExportRelease(dir string) (returnedError error) {
+	reader, err := configContainer.dockerClient.CopyFromContainer(configContainer.id, "/release/")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			if returnedError != nil {
+				returnedError = fmt.Errorf("%w, also %v", returnedError, err)
+			} else {
+				returnedError = err
+			}
+			return
+		}
+	}()
+
+	// entries are relative to the parent of /release
+	return util.ExtractTar(reader, dir, 1)
+}
+
 type uploadReleaseRequest struct {
 	Action         string
 	TerraformImage string
@@ -315,8 +382,410 @@ func (configContainer *Container) PrepareTerraform(
 	return &response, nil
 }
 
+type listDeploymentsRequest struct {
+	Action    string
+	Component string
+	Config    map[string]interface{}
+	Env       map[string]string
+	EnvName   string
+}
+
+// The outcomes of a deployment, as recorded with RecordDeployment.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Deployment is a version that was deployed to an environment.
+type Deployment struct {
+	Version string
+	Commit  string
+	Time    string
+	Outcome string
+}
+
+// Succeeded returns true if the deployment succeeded. Deployments without an outcome (from config containers that
+// don't record them) are assumed to have succeeded.
+func (deployment *Deployment) Succeeded() bool {
+	return deployment.Outcome == OutcomeSuccess || deployment.Outcome == ""
+}
+
+// ListDeploymentsResponse contains the response to the list deployments request.
+type ListDeploymentsResponse struct {
+	Deployments []*Deployment
+	Success     bool
+}
+
+// ListDeployments requests the deployment history for an environment, most recent first.
+func (configContainer *Container) ListDeployments(
+	component, envName string,
+	config map[string]interface{},
+	env map[string]string,
+) (*ListDeploymentsResponse, error) {
+	if err := configContainer.checkSupported("list_deployments"); err != nil {
+		return nil, err
+	}
+	var response ListDeploymentsResponse
+	if err := configContainer.request(&listDeploymentsRequest{
+		Action:    "list_deployments",
+		Component: component,
+		Config:    config,
+		Env:       env,
+		EnvName:   envName,
+	}, &response); err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		return nil, errors.New("config container failed to list deployments")
+	}
+	return &response, nil
+}
+
+type recordDeploymentRequest struct {
+	Action      string
+	Version     string
+	Component   string
+	Commit      string
+	Config      map[string]interface{}
+	Env         map[string]string
+	EnvName     string
+	PlanSummary string
+	Outcome     string
+	Error       string
+}
+
+// RecordDeploymentResponse contains the response to the record deployment request.
+type RecordDeploymentResponse struct {
+	Success bool
+}
+
+// RecordDeployment informs the config container of the outcome of a deployment, so it can keep a deployment history.
+func (configContainer *Container) RecordDeployment(
+	version, component, commit, envName, planSummary, outcome, errorMessage string,
+	config map[string]interface{},
+	env map[string]string,
+) (*RecordDeploymentResponse, error) {
+	if err := configContainer.checkSupported("record_deployment"); err != nil {
+		return nil, err
+	}
+	var response RecordDeploymentResponse
+	if err := configContainer.request(&recordDeploymentRequest{
+		Action:      "record_deployment",
+		Version:     version,
+		Component:   component,
+		Commit:      commit,
+		Config:      config,
+		Env:         env,
+		EnvName:     envName,
+		PlanSummary: planSummary,
+		Outcome:     outcome,
+		Error:       errorMessage,
+	}, &response); err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		return nil, errors.New("config container failed to record deployment")
+	}
+	return &response, nil
+}
+
+// RecordDeployment creates a config container and records the outcome of a deployment in one.
+func RecordDeployment(ctx context.Context, state *command.GlobalState, envName, version, planSummary, outcome, errorMessage string, env map[string]string) (returnedError error) {
+	configContainer, err := NewContainer(ctx, state, state.Manifest.Config.Image, "")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := configContainer.Done(); err != nil {
+			if returnedError != nil {
+				returnedError = fmt.Errorf("%w, also %v", returnedError, err)
+			} else {
+				returnedError = err
+			}
+			return
+		}
+	}()
+
+	_, err = configContainer.RecordDeployment(version, state.Component, state.Commit, envName, planSummary, outcome, errorMessage, state.Manifest.Config.Params, env)
+	return err
+}
+
+type lockEnvironmentRequest struct {
+	Action    string
+	Component string
+	Config    map[string]interface{}
+	Env       map[string]string
+	EnvName   string
+	LockedBy  string
+	Reason    string
+}
+
+// LockEnvironmentResponse contains the response to the lock environment request.
+type LockEnvironmentResponse struct {
+	Success bool
+}
+
+// LockEnvironment requests that an environment is locked so that it can't be deployed to or destroyed.
+func (configContainer *Container) LockEnvironment(
+	component, envName, lockedBy, reason string,
+	config map[string]interface{},
+	env map[string]string,
+) (*LockEnvironmentResponse, error) {
+	if err := configContainer.checkSupported("lock_environment"); err != nil {
+		return nil, err
+	}
+	var response LockEnvironmentResponse
+	if err := configContainer.request(&lockEnvironmentRequest{
+		Action:    "lock_environment",
+		Component: component,
+		Config:    config,
+		Env:       env,
+		EnvName:   envName,
+		LockedBy:  lockedBy,
+		Reason:    reason,
+	}, &response); err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		return nil, errors.New("config container failed to lock environment")
+	}
+	return &response, nil
+}
+
+type environmentLockRequest struct {
+	Action    string
+	Component string
+	Config    map[string]interface{}
+	Env       map[string]string
+	EnvName   string
+}
+
+// UnlockEnvironmentResponse contains the response to the unlock environment request.
+type UnlockEnvironmentResponse struct {
+	Success bool
+}
+
+// UnlockEnvironment requests that the lock on an environment is removed.
+func (configContainer *Container) UnlockEnvironment(
+	component, envName string,
+	config map[string]interface{},
+	env map[string]string,
+) (*UnlockEnvironmentResponse, error) {
+	if err := configContainer.checkSupported("unlock_environment"); err != nil {
+		return nil, err
+	}
+	var response UnlockEnvironmentResponse
+	if err := configContainer.request(&environmentLockRequest{
+		Action:    "unlock_environment",
+		Component: component,
+		Config:    config,
+		Env:       env,
+		EnvName:   envName,
+	}, &response); err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		return nil, errors.New("config container failed to unlock environment")
+	}
+	return &response, nil
+}
+
+// Lock describes who locked an environment and why.
+type Lock struct {
+	LockedBy string
+	Reason   string
+	Time     string
+}
+
+// GetEnvironmentLockResponse contains the response to the get environment lock request.
+type GetEnvironmentLockResponse struct {
+	Lock    *Lock
+	Success bool
+}
+
+// GetEnvironmentLock requests the lock on an environment, which is nil if the environment isn't locked.
+func (configContainer *Container) GetEnvironmentLock(
+	component, envName string,
+	config map[string]interface{},
+	env map[string]string,
+) (*GetEnvironmentLockResponse, error) {
+	if err := configContainer.checkSupported("get_environment_lock"); err != nil {
+		return nil, err
+	}
+	var response GetEnvironmentLockResponse
+	if err := configContainer.request(&environmentLockRequest{
+		Action:    "get_environment_lock",
+		Component: component,
+		Config:    config,
+		Env:       env,
+		EnvName:   envName,
+	}, &response); err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		return nil, errors.New("config container failed to get environment lock")
+	}
+	return &response, nil
+}
+
+// GetEnvironmentLock creates a config container and gets the lock on an environment in one.
+func GetEnvironmentLock(ctx context.Context, state *command.GlobalState, envName string, env map[string]string) (_ *Lock, returnedError error) {
+	configContainer, err := NewContainer(ctx, state, state.Manifest.Config.Image, "")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := configContainer.Done(); err != nil {
+			if returnedError != nil {
+				returnedError = fmt.Errorf("%w, also %v", returnedError, err)
+			} else {
+				returnedError = err
+			}
+			return
+		}
+	}()
+
+	response, err := configContainer.GetEnvironmentLock(state.Component, envName, state.Manifest.Config.Params, env)
+	if err != nil {
+		return nil, err
+	}
+	return response.Lock, nil
+}
+
+// Release describes a stored release.
+type Release struct {
+	Version  string
+	Commit   string
+	Created  string
+	Metadata map[string]map[string]string
+}
+
+type listReleasesRequest struct {
+	Action    string
+	Component string
+	Config    map[string]interface{}
+	Env       map[string]string
+}
+
+// ListReleasesResponse contains the response to the list releases request.
+type ListReleasesResponse struct {
+	Releases []*Release
+	Success  bool
+}
+
+// ListReleases requests the stored releases for the component, most recent first.
+func (configContainer *Container) ListReleases(
+	component string,
+	config map[string]interface{},
+	env map[string]string,
+) (*ListReleasesResponse, error) {
+	if err := configContainer.checkSupported("list_releases"); err != nil {
+		return nil, err
+	}
+	var response ListReleasesResponse
+	if err := configContainer.request(&listReleasesRequest{
+		Action:    "list_releases",
+		Component: component,
+		Config:    config,
+		Env:       env,
+	}, &response); err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		return nil, errors.New("config container failed to list releases")
+	}
+	return &response, nil
+}
+
+type getReleaseRequest struct {
+	Action    string
+	Version   string
+	Component string
+	Config    map[string]interface{}
+	Env       map[string]string
+}
+
+// GetReleaseResponse contains the response to the get release request.
+type GetReleaseResponse struct {
+	Release *Release
+	Success bool
+}
+
+// GetRelease requests the details of a single stored release.
+func (configContainer *Container) GetRelease(
+	version, component string,
+	config map[string]interface{},
+	env map[string]string,
+) (*GetReleaseResponse, error) {
+	if err := configContainer.checkSupported("get_release"); err != nil {
+		return nil, err
+	}
+	var response GetReleaseResponse
+	if err := configContainer.request(&getReleaseRequest{
+		Action:    "get_release",
+		Version:   version,
+		Component: component,
+		Config:    config,
+		Env:       env,
+	}, &response); err != nil {
+		return nil, err
+	}
+	if !response.Success || response.Release == nil {
+		return nil, fmt.Errorf("config container failed to get release %v", version)
+	}
+	return &response, nil
+}
+
+type readReleaseFileRequest struct {
+	Action    string
+	Version   string
+	Component string
+	Filename  string
+	Config    map[string]interface{}
+	Env       map[string]string
+}
+
+// ReadReleaseFileResponse contains the response to the read release file request.
+type ReadReleaseFileResponse struct {
+	Content []byte
+	Found   bool
+	Success bool
+}
+
+// ErrReleaseFileNotFound is wrapped by the error from ReadReleaseFile when the file isn't in the release.
+var ErrReleaseFileNotFound = errors.New("file not found in release")
+
+// ReadReleaseFile requests the content of a file saved in a stored release.
+func (configContainer *Container) ReadReleaseFile(
+	version, component, filename string,
+	config map[string]interface{},
+	env map[string]string,
+) ([]byte, error) {
+	if err := configContainer.checkSupported("read_release_file"); err != nil {
+		return nil, err
+	}
+	var response ReadReleaseFileResponse
+	if err := configContainer.request(&readReleaseFileRequest{
+		Action:    "read_release_file",
+		Version:   version,
+		Component: component,
+		Filename:  filename,
+		Config:    config,
+		Env:       env,
+	}, &response); err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		return nil, fmt.Errorf("config container failed to read %v from release %v", filename, version)
+	}
+	if !response.Found {
+		return nil, fmt.Errorf("%w: %s", ErrReleaseFileNotFound, filename)
+	}
+	return response.Content, nil
+}
+
 // SetupTerraform creates the config container and prepares terraform in one.
-func SetupTerraform(state *command.GlobalState, stateShouldExist *bool, envName, version string, env map[string]string) (_ *PrepareTerraformResponse, returnedBuildVolume string, terraformImage string, returnedError error) {
+func SetupTerraform(ctx context.Context, state *command.GlobalState, stateShouldExist *bool, envName, version string, env map[string]string) (_ *PrepareTerraformResponse, returnedBuildVolume string, terraformImage string, returnedError error) {
 	dockerClient := state.DockerClient
 
 	if err := Pull(state); err != nil {
@@ -328,7 +797,7 @@ func SetupTerraform(state *command.GlobalState, stateShouldExist *bool, envName,
 		return nil, "", "", err
 	}
 
-	configContainer, err := NewContainer(state, state.Manifest.Config.Image, buildVolume)
+	configContainer, err := NewContainer(ctx, state, state.Manifest.Config.Image, buildVolume)
 	if err != nil {
 		return nil, "", "", err
 	}
@@ -343,8 +812,8 @@ func SetupTerraform(state *command.GlobalState, stateShouldExist *bool, envName,
 		}
 	}()
 
-	terraformVersion := getTerraformVersion(state.Manifest.Terraform.Image)
-	fmt.Printf("Using terraform version %v\n", terraformVersion)
+	terraformVersion := GetTerraformVersion(state.Manifest.Terraform.Image)
+	fmt.Fprintf(state.ErrorStream, "Using terraform version %v\n", terraformVersion)
 
 	prepareTerraformResponse, err := configContainer.PrepareTerraform(version, state.Component, state.Commit, envName, stateShouldExist, state.Manifest.Config.Params, env, terraformVersion)
 	if err != nil {
@@ -369,7 +838,7 @@ func SetupTerraform(state *command.GlobalState, stateShouldExist *bool, envName,
 // Done stops and removes the config container.
 func (configContainer *Container) Done() error {
 	if !configContainer.finished {
-		if err := configContainer.dockerClient.Stop(configContainer.id, 2); err != nil {
+		if err := configContainer.dockerClient.Stop(context.Background(), configContainer.id, 2); err != nil {
 			return err
 		}
 	}
@@ -388,7 +857,8 @@ func Pull(state *command.GlobalState) error {
 	return nil
 }
 
-func getTerraformVersion(terraformImage string) string {
+// GetTerraformVersion returns the tag of the terraform image (or "latest" if it has no tag).
+func GetTerraformVersion(terraformImage string) string {
 	parts := strings.Split(terraformImage, ":")
 	if len(parts) < 2 {
 		return "latest"
@@ -2,7 +2,9 @@ package config_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"reflect"
 	"testing"
 
@@ -33,7 +35,7 @@ func TestConfigRelease(t *testing.T) {
 
 	// When
 	func() {
-		configContainer, err := config.NewContainer(state, test.GetConfig("TEST_CONFIG_IMAGE"), releaseVolume)
+		configContainer, err := config.NewContainer(context.Background(), state, test.GetConfig("TEST_CONFIG_IMAGE"), releaseVolume)
 		if err != nil {
 			t.Fatal("error creating config container:", err)
 		}
@@ -149,7 +151,7 @@ func TestConfigDeploy(t *testing.T) {
 
 	// When
 	func() {
-		configContainer, err := config.NewContainer(state, test.GetConfig("TEST_CONFIG_IMAGE"), releaseVolume)
+		configContainer, err := config.NewContainer(context.Background(), state, test.GetConfig("TEST_CONFIG_IMAGE"), releaseVolume)
 		if err != nil {
 			t.Fatal("error creating config container:", err)
 		}
@@ -232,3 +234,346 @@ func TestConfigDeploy(t *testing.T) {
 		t.Fatal("expected env name test-env passed to prepare terraform, got:", prepareTerraformDebugOutput.Request.EnvName)
 	}
 }
+
+func TestSupportedActions(t *testing.T) {
+	actions := config.SupportedActions(map[string]string{
+		config.LabelActions: "list_deployments, record_deployment,",
+	})
+	if !reflect.DeepEqual(actions, map[string]bool{
+		"list_deployments":  true,
+		"record_deployment": true,
+	}) {
+		t.Fatal("unexpected actions:", actions)
+	}
+
+	if actions := config.SupportedActions(nil); len(actions) != 0 {
+		t.Fatal("expected no actions without the label, got:", actions)
+	}
+}
+
+func TestConfigDeploymentHistory(t *testing.T) {
+	// Given
+	dockerClient, debugVolume := test.GetDockerClientWithDebugVolume()
+	defer test.RemoveVolume(dockerClient, debugVolume)
+
+	var outputBuffer bytes.Buffer
+	var errorBuffer bytes.Buffer
+
+	state := &command.GlobalState{
+		DockerClient: dockerClient,
+		OutputStream: &outputBuffer,
+		ErrorStream:  &errorBuffer,
+	}
+
+	var listDeploymentsResponse *config.ListDeploymentsResponse
+
+	// When
+	func() {
+		configContainer, err := config.NewContainer(context.Background(), state, test.GetConfig("TEST_CONFIG_IMAGE"), "")
+		if err != nil {
+			t.Fatal("error creating config container:", err)
+		}
+		defer func() {
+			if err := configContainer.Done(); err != nil {
+				t.Fatal("error stopping config container:", err)
+			}
+		}()
+
+		for _, deployment := range []struct{ version, outcome string }{
+			{"1", config.OutcomeSuccess},
+			{"2", config.OutcomeFailure},
+		} {
+			if _, err := configContainer.RecordDeployment(
+				deployment.version,
+				"test-component",
+				"test-commit",
+				"test-env",
+				"1 to add, 0 to change, 0 to destroy",
+				deployment.outcome,
+				"",
+				map[string]interface{}{},
+				map[string]string{},
+			); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		listDeploymentsResponse, err = configContainer.ListDeployments(
+			"test-component",
+			"test-env",
+			map[string]interface{}{},
+			map[string]string{},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Then
+	if !reflect.DeepEqual(listDeploymentsResponse.Deployments, []*config.Deployment{
+		{Version: "2", Commit: "test-commit", Time: "2020-01-01T00:00:00Z", Outcome: config.OutcomeFailure},
+		{Version: "1", Commit: "test-commit", Time: "2020-01-01T00:00:00Z", Outcome: config.OutcomeSuccess},
+	}) {
+		t.Fatalf("unexpected deployments: %+v", listDeploymentsResponse.Deployments)
+	}
+
+	debugInfo, err := test.ReadVolume(dockerClient, debugVolume)
+	if err != nil {
+		t.Fatal("error getting debug info:", err)
+	}
+
+	var recordDeploymentDebugOutput struct {
+		Action  string
+		Request struct {
+			EnvName     string
+			PlanSummary string
+		}
+	}
+
+	if err := json.Unmarshal(debugInfo["record-deployment.json"], &recordDeploymentDebugOutput); err != nil {
+		t.Fatal("error decoding record deployment debug output:", err)
+	}
+
+	if recordDeploymentDebugOutput.Action != "record_deployment" {
+		t.Fatal("expected record_deployment, got ", recordDeploymentDebugOutput.Action)
+	}
+
+	if recordDeploymentDebugOutput.Request.EnvName != "test-env" {
+		t.Fatal("expected env name test-env passed to record deployment, got:", recordDeploymentDebugOutput.Request.EnvName)
+	}
+
+	if recordDeploymentDebugOutput.Request.PlanSummary != "1 to add, 0 to change, 0 to destroy" {
+		t.Fatal("unexpected plan summary passed to record deployment:", recordDeploymentDebugOutput.Request.PlanSummary)
+	}
+}
+
+func TestConfigReleases(t *testing.T) {
+	// Given
+	dockerClient, debugVolume := test.GetDockerClientWithDebugVolume()
+	defer test.RemoveVolume(dockerClient, debugVolume)
+
+	var outputBuffer bytes.Buffer
+	var errorBuffer bytes.Buffer
+
+	state := &command.GlobalState{
+		DockerClient: dockerClient,
+		OutputStream: &outputBuffer,
+		ErrorStream:  &errorBuffer,
+	}
+
+	var listReleasesResponse *config.ListReleasesResponse
+	var getReleaseResponse *config.GetReleaseResponse
+	var terraformImage []byte
+	var missingFileErr error
+
+	// When
+	func() {
+		configContainer, err := config.NewContainer(context.Background(), state, test.GetConfig("TEST_CONFIG_IMAGE"), "")
+		if err != nil {
+			t.Fatal("error creating config container:", err)
+		}
+		defer func() {
+			if err := configContainer.Done(); err != nil {
+				t.Fatal("error stopping config container:", err)
+			}
+		}()
+
+		listReleasesResponse, err = configContainer.ListReleases(
+			"test-component",
+			map[string]interface{}{},
+			map[string]string{},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		getReleaseResponse, err = configContainer.GetRelease(
+			"test-version",
+			"test-component",
+			map[string]interface{}{},
+			map[string]string{},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		terraformImage, err = configContainer.ReadReleaseFile(
+			"test-version",
+			"test-component",
+			"terraform-image",
+			map[string]interface{}{},
+			map[string]string{},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, missingFileErr = configContainer.ReadReleaseFile(
+			"test-version",
+			"test-component",
+			".terraform.lock.hcl",
+			map[string]interface{}{},
+			map[string]string{},
+		)
+	}()
+
+	// Then
+	var versions []string
+	for _, release := range listReleasesResponse.Releases {
+		versions = append(versions, release.Version)
+	}
+	if !reflect.DeepEqual(versions, []string{"2", "1"}) {
+		t.Fatal("unexpected release versions:", versions)
+	}
+
+	if !reflect.DeepEqual(getReleaseResponse.Release, &config.Release{
+		Version: "test-version",
+		Commit:  "commit-for-test-version",
+		Created: "2020-01-01T00:00:00Z",
+		Metadata: map[string]map[string]string{
+			"release": {"version": "test-version"},
+		},
+	}) {
+		t.Fatalf("unexpected release: %+v", getReleaseResponse.Release)
+	}
+
+	if string(terraformImage) != "terraform-image-for-test-version" {
+		t.Fatal("unexpected terraform image:", string(terraformImage))
+	}
+
+	if !errors.Is(missingFileErr, config.ErrReleaseFileNotFound) {
+		t.Fatal("expected file not found error, got:", missingFileErr)
+	}
+
+	debugInfo, err := test.ReadVolume(dockerClient, debugVolume)
+	if err != nil {
+		t.Fatal("error getting debug info:", err)
+	}
+
+	var getReleaseDebugOutput struct {
+		Action  string
+		Request struct {
+			Component string
+		}
+	}
+
+	if err := json.Unmarshal(debugInfo["get-release.json"], &getReleaseDebugOutput); err != nil {
+		t.Fatal("error decoding get release debug output:", err)
+	}
+
+	if getReleaseDebugOutput.Action != "get_release" {
+		t.Fatal("expected get_release, got ", getReleaseDebugOutput.Action)
+	}
+
+	if getReleaseDebugOutput.Request.Component != "test-component" {
+		t.Fatal("expected component test-component passed to get release, got:", getReleaseDebugOutput.Request.Component)
+	}
+}
+
+func TestConfigEnvironmentLock(t *testing.T) {
+	// Given
+	dockerClient, debugVolume := test.GetDockerClientWithDebugVolume()
+	defer test.RemoveVolume(dockerClient, debugVolume)
+
+	var outputBuffer bytes.Buffer
+	var errorBuffer bytes.Buffer
+
+	state := &command.GlobalState{
+		DockerClient: dockerClient,
+		OutputStream: &outputBuffer,
+		ErrorStream:  &errorBuffer,
+	}
+
+	var lockedResponse *config.GetEnvironmentLockResponse
+	var unlockedResponse *config.GetEnvironmentLockResponse
+
+	// When
+	func() {
+		configContainer, err := config.NewContainer(context.Background(), state, test.GetConfig("TEST_CONFIG_IMAGE"), "")
+		if err != nil {
+			t.Fatal("error creating config container:", err)
+		}
+		defer func() {
+			if err := configContainer.Done(); err != nil {
+				t.Fatal("error stopping config container:", err)
+			}
+		}()
+
+		if _, err := configContainer.LockEnvironment(
+			"test-component",
+			"test-env",
+			"test-user",
+			"test reason",
+			map[string]interface{}{},
+			map[string]string{},
+		); err != nil {
+			t.Fatal(err)
+		}
+
+		lockedResponse, err = configContainer.GetEnvironmentLock(
+			"test-component",
+			"test-env",
+			map[string]interface{}{},
+			map[string]string{},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := configContainer.UnlockEnvironment(
+			"test-component",
+			"test-env",
+			map[string]interface{}{},
+			map[string]string{},
+		); err != nil {
+			t.Fatal(err)
+		}
+
+		unlockedResponse, err = configContainer.GetEnvironmentLock(
+			"test-component",
+			"test-env",
+			map[string]interface{}{},
+			map[string]string{},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Then
+	if !reflect.DeepEqual(lockedResponse.Lock, &config.Lock{
+		LockedBy: "test-user",
+		Reason:   "test reason",
+		Time:     "2020-01-01T00:00:00Z",
+	}) {
+		t.Fatalf("unexpected lock: %+v", lockedResponse.Lock)
+	}
+
+	if unlockedResponse.Lock != nil {
+		t.Fatalf("expected no lock after unlocking, got: %+v", unlockedResponse.Lock)
+	}
+
+	debugInfo, err := test.ReadVolume(dockerClient, debugVolume)
+	if err != nil {
+		t.Fatal("error getting debug info:", err)
+	}
+
+	var lockEnvironmentDebugOutput struct {
+		Action  string
+		Request struct {
+			EnvName string
+		}
+	}
+
+	if err := json.Unmarshal(debugInfo["lock-environment.json"], &lockEnvironmentDebugOutput); err != nil {
+		t.Fatal("error decoding lock environment debug output:", err)
+	}
+
+	if lockEnvironmentDebugOutput.Action != "lock_environment" {
+		t.Fatal("expected lock_environment, got ", lockEnvironmentDebugOutput.Action)
+	}
+
+	if lockEnvironmentDebugOutput.Request.EnvName != "test-env" {
+		t.Fatal("expected env name test-env passed to lock environment, got:", lockEnvironmentDebugOutput.Request.EnvName)
+	}
+}
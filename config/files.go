@@ -0,0 +1,27 @@
+package config
+
+import (
+	"os"
+	"path"
+
+	"github.com/mergermarket/cdflow2/command"
+)
+
+// ConfigFiles returns the common and environment (unless envName is empty) config files that exist, relative to the
+// repository.
+func ConfigFiles(state *command.GlobalState, envName string) []string {
+	var result []string
+	commonConfigFile := path.Join(state.ConfigFilesFolder, "common.json")
+	if _, err := os.Stat(commonConfigFile); !os.IsNotExist(err) {
+		result = append(result, commonConfigFile)
+	}
+
+	if envName != "" {
+		envConfigFilename := path.Join(state.ConfigFilesFolder, envName+".json")
+		if _, err := os.Stat(envConfigFilename); !os.IsNotExist(err) {
+			result = append(result, envConfigFilename)
+		}
+	}
+
+	return result
+}
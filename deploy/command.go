@@ -1,16 +1,18 @@
 package deploy
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"os"
-	"path"
 	"strings"
 
 	"github.com/mergermarket/cdflow2/command"
 	"github.com/mergermarket/cdflow2/config"
+	"github.com/mergermarket/cdflow2/lock"
 	"github.com/mergermarket/cdflow2/terraform"
+	"github.com/mergermarket/cdflow2/trivy"
 	"github.com/mergermarket/cdflow2/util"
 )
 
@@ -23,6 +25,45 @@ type CommandArgs struct {
 	StateShouldExist       *bool
 	ErrorOnResourceDestroy bool
 	RefreshOnly            bool
+	Force                  bool
+	AcceptFindings         bool
+}
+
+// NewArgParser returns the parser for the deploy options and arguments, which sets result.
+func NewArgParser(result *CommandArgs) *command.ArgParser {
+	return &command.ArgParser{
+		Name: "deploy",
+		Options: []command.Option{
+			command.Flag("plan-only", "p", func() { result.PlanOnly = true }),
+			command.Flag("refresh-only", "r", func() { result.RefreshOnly = true }),
+			command.Flag("new-state", "n", func() {
+				var F = false
+				result.StateShouldExist = &F
+			}),
+			command.Flag("error-on-destroy", "e", func() { result.ErrorOnResourceDestroy = true }),
+			// never defaulted, so that overriding a lock is always an explicit choice
+			{Long: "force", Short: "f", NoDefault: true, Handle: func(string) error {
+				result.Force = true
+				return nil
+			}},
+			command.StringValue("terraform-log-level", "t", &result.TerraformLogLevel),
+			// never defaulted, so that deploying with findings is always an explicit choice
+			{Long: "accept-findings", NoDefault: true, Handle: func(string) error {
+				result.AcceptFindings = true
+				return nil
+			}},
+		},
+		HandleArg: func(arg string) (bool, error) {
+			if result.EnvName == "" {
+				result.EnvName = arg
+			} else if result.Version == "" {
+				result.Version = arg
+			} else {
+				return false, errors.New("unknown deploy argument: " + arg)
+			}
+			return false, nil
+		},
+	}
 }
 
 // ParseArgs parses command line arguments to the deploy subcommand.
@@ -31,20 +72,9 @@ func ParseArgs(args []string) (*CommandArgs, error) {
 	var T = true
 	result.StateShouldExist = &T // set default to true
 
-	i := 0
-	take := func() (string, error) {
-		i++
-		if i >= len(args) {
-			return "", errors.New("missing value")
-		}
-
-		return args[i], nil
-	}
-	for ; i < len(args); i++ {
-		_, err := handleArgs(args[i], &result, take)
-		if err != nil {
-			return nil, err
-		}
+	parser := NewArgParser(&result)
+	if _, err := parser.Parse(args); err != nil {
+		return nil, err
 	}
 
 	if result.EnvName == "" {
@@ -58,50 +88,92 @@ func ParseArgs(args []string) (*CommandArgs, error) {
 	return &result, nil
 }
 
-func handleArgs(arg string, commandArgs *CommandArgs, take func() (string, error)) (bool, error) {
-	if strings.HasPrefix(arg, "-") {
-		return handleFlag(arg, commandArgs, take)
-	} else if commandArgs.EnvName == "" {
-		commandArgs.EnvName = arg
-	} else if commandArgs.Version == "" {
-		commandArgs.Version = arg
-	} else {
-		return false, errors.New("unknown deploy argument: " + arg)
-	}
-	return false, nil
+func hasResourceDelete(plan string) bool {
+	return !strings.Contains(plan, "0 to destroy")
 }
 
-func handleFlag(arg string, commandArgs *CommandArgs, take func() (string, error)) (bool, error) {
-	var F = false
-
-	if arg == "-p" || arg == "--plan-only" {
-		commandArgs.PlanOnly = true
-	} else if arg == "-r" || arg == "--refresh-only" {
-		commandArgs.RefreshOnly = true
-	} else if arg == "-n" || arg == "--new-state" {
-		commandArgs.StateShouldExist = &F
-	} else if arg == "-e" || arg == "--error-on-destroy" {
-		commandArgs.ErrorOnResourceDestroy = true
-	} else if arg == "-t" || arg == "--terraform-log-level" {
-		value, err := take()
-		if err != nil {
-			return false, err
-		}
+// MONITORING_ACCEPTED_FINDINGS is the monitoring tag set when a release with security findings is deployed into a
+// protected environment with --accept-findings.
+const MONITORING_ACCEPTED_FINDINGS = "deploy_accepted_security_findings"
 
-		commandArgs.TerraformLogLevel = value
-	} else {
-		return false, errors.New("unknown deploy option: " + arg)
+// CheckSecurityFindings returns an error if the release (from the contents of release-metadata.json) has security
+// findings and the environment is in protected_environments in cdflow.yaml, unless acceptFindings is set, in which
+// case a warning is shown and the override is recorded in monitoring.
+func CheckSecurityFindings(state *command.GlobalState, envName string, releaseMetadataJSON []byte, acceptFindings bool) error {
+	if !state.Manifest.IsProtectedEnvironment(envName) {
+		return nil
+	}
+	var releaseMetadata map[string]map[string]string
+	if err := json.Unmarshal(releaseMetadataJSON, &releaseMetadata); err != nil {
+		return fmt.Errorf("error parsing release metadata: %w", err)
+	}
+	findings, err := trivy.GetReleaseFindings(releaseMetadata)
+	if err != nil {
+		return err
 	}
-	return false, nil
+	if findings == nil || !findings.Fail() {
+		return nil
+	}
+
+	fmt.Fprint(state.ErrorStream, "\ncdflow2: security findings...\n\n")
+	if err := trivy.WriteFindingsTable(state.ErrorStream, findings.Table()); err != nil {
+		return err
+	}
+	if !acceptFindings {
+		return fmt.Errorf(
+			"the release has security findings and %s is a protected environment - use --accept-findings to deploy it anyway",
+			envName,
+		)
+	}
+	fmt.Fprintf(state.ErrorStream, "\n%s\n", util.FormatWarning(fmt.Sprintf(
+		"deploying a release with security findings to protected environment %s (--accept-findings)", envName,
+	)))
+	if state.MonitoringClient.ConfigData == nil {
+		state.MonitoringClient.ConfigData = make(map[string]string)
+	}
+	state.MonitoringClient.ConfigData[MONITORING_ACCEPTED_FINDINGS] = "true"
+	return nil
 }
 
-func hasResourceDelete(plan string) bool {
-	return !strings.Contains(plan, "0 to destroy")
+// recordDeployment tells the config container the outcome of the deployment, unless it doesn't support the
+// record_deployment action - failure to do so is reported but does not fail the deploy. This also happens
+// when the deploy is interrupted, so that is recorded as a failure. Deploys that stop before the plan (e.g.
+// because the environment is locked) aren't deployments, so aren't recorded.
+func recordDeployment(ctx context.Context, state *command.GlobalState, args *CommandArgs, env map[string]string, planSummary string, deployError error) {
+	outcome := config.OutcomeSuccess
+	errorMessage := ""
+	if deployError != nil {
+		outcome = config.OutcomeFailure
+		errorMessage = deployError.Error()
+	}
+	err := config.RecordDeployment(context.WithoutCancel(ctx), state, args.EnvName, args.Version, planSummary, outcome, errorMessage, env)
+	var unsupportedActionError *config.UnsupportedActionError
+	if err != nil && !errors.As(err, &unsupportedActionError) {
+		fmt.Fprintf(state.ErrorStream, "\n%s\n", util.FormatWarning(fmt.Sprintf("unable to record deployment: %v", err)))
+	}
 }
 
 // RunCommand runs the release command.
-func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]string) (returnedError error) {
-	prepareTerraformResponse, buildVolume, terraformImage, err := config.SetupTerraform(state, args.StateShouldExist, args.EnvName, args.Version, env)
+func RunCommand(ctx context.Context, state *command.GlobalState, args *CommandArgs, env map[string]string) (returnedError error) {
+	planSummary := ""
+	started := false
+	if !args.PlanOnly && !args.RefreshOnly {
+		defer func() {
+			if started {
+				recordDeployment(ctx, state, args, env, planSummary, returnedError)
+			}
+		}()
+	}
+
+	if state.Manifest.Trivy.Image != "" && !args.RefreshOnly {
+		if err := scanInfra(ctx, state, args.EnvName); err != nil {
+			return err
+		}
+	}
+
+	endPhase := state.Result.StartPhase("setup-terraform")
+	prepareTerraformResponse, buildVolume, terraformImage, err := config.SetupTerraform(ctx, state, args.StateShouldExist, args.EnvName, args.Version, env)
+	endPhase()
 	if err != nil {
 		return err
 	}
@@ -117,6 +189,7 @@ func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]st
 	}()
 
 	terraformContainer, err := terraform.NewContainer(
+		ctx,
 		state.DockerClient,
 		terraformImage,
 		state.CodeDir,
@@ -136,6 +209,7 @@ func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]st
 		}
 	}()
 
+	endPhase = state.Result.StartPhase("init")
 	if err := terraformContainer.CopyTerraformLockIfExists(state.OutputStream, state.ErrorStream); err != nil {
 		return err
 	}
@@ -143,6 +217,24 @@ func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]st
 	if err := terraformContainer.ConfigureBackend(state.OutputStream, state.ErrorStream, prepareTerraformResponse, false); err != nil {
 		return err
 	}
+	endPhase()
+
+	if !args.PlanOnly && !args.RefreshOnly && state.Manifest.IsProtectedEnvironment(args.EnvName) {
+		releaseMetadata, err := terraformContainer.ReadFile("/build/release-metadata.json", state.ErrorStream)
+		if err != nil {
+			return err
+		}
+		if err := CheckSecurityFindings(state, args.EnvName, releaseMetadata, args.AcceptFindings); err != nil {
+			return err
+		}
+	}
+
+	if !args.PlanOnly {
+		if err := lock.Check(ctx, state, args.EnvName, args.Force, env); err != nil {
+			return err
+		}
+	}
+	started = true
 
 	if err := terraformContainer.SwitchWorkspace(args.EnvName, state.OutputStream, state.ErrorStream); err != nil {
 		return err
@@ -154,14 +246,16 @@ func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]st
 			"apply",
 			"-refresh-only",
 			"-auto-approve"}
-		refreshCommand = appendConfigFiles(refreshCommand, state, args.EnvName)
+		refreshCommand = AppendConfigFiles(refreshCommand, state, args.EnvName)
 
+		endPhase = state.Result.StartPhase("refresh")
 		if err := terraformContainer.RunCommand(
 			refreshCommand, prepareTerraformResponse.Env,
 			state.OutputStream, state.ErrorStream,
 		); err != nil {
 			return err
 		}
+		endPhase()
 
 		return nil
 	}
@@ -172,7 +266,7 @@ func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]st
 		"terraform",
 		"plan"}
 
-	planCommand = appendConfigFiles(planCommand, state, args.EnvName)
+	planCommand = AppendConfigFiles(planCommand, state, args.EnvName)
 
 	planCommand = append(
 		planCommand,
@@ -188,12 +282,18 @@ func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]st
 	var planBuff strings.Builder
 	multiWriter := io.MultiWriter(state.OutputStream, &planBuff)
 
+	endPhase = state.Result.StartPhase("plan")
 	if err := terraformContainer.RunCommand(
 		planCommand, prepareTerraformResponse.Env,
 		multiWriter, state.ErrorStream,
 	); err != nil {
 		return err
 	}
+	endPhase()
+	planSummary = terraform.GetPlanSummary(planBuff.String())
+	if add, change, destroy, ok := terraform.GetPlanCounts(planBuff.String()); ok {
+		state.Result.SetPlan(add, change, destroy)
+	}
 
 	if args.ErrorOnResourceDestroy {
 		if hasResourceDelete(planBuff.String()) {
@@ -212,25 +312,69 @@ func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]st
 		util.FormatCommand("terraform apply "+planFilename),
 	)
 
+	endPhase = state.Result.StartPhase("apply")
 	if err := terraformContainer.RunCommand(
 		[]string{"terraform", "apply", planFilename}, prepareTerraformResponse.Env,
 		state.OutputStream, state.ErrorStream,
 	); err != nil {
 		return err
 	}
+	endPhase()
 
 	return nil
 }
 
-func appendConfigFiles(command []string, state *command.GlobalState, envName string) []string {
-	commonConfigFile := path.Join(state.ConfigFilesFolder, "common.json")
-	if _, err := os.Stat(commonConfigFile); !os.IsNotExist(err) {
-		command = append(command, "-var-file=../"+commonConfigFile)
+// scanInfra scans the terraform code with the config files for the environment for misconfigurations if infraScanOnDeploy
+// is set in the trivy params, printing the findings - which fail the deploy if errorOnFindings is set.
+func scanInfra(ctx context.Context, state *command.GlobalState, envName string) (returnedError error) {
+	trivyConfig, err := trivy.GetConfig(state.Manifest.Trivy.Params)
+	if err != nil {
+		return fmt.Errorf("cdflow2: error getting trivy config: %w", err)
+	}
+	if !trivyConfig.InfraScanOnDeploy() {
+		return nil
+	}
+
+	image := state.Manifest.Trivy.Image
+	if !state.GlobalArgs.NoPullScan {
+		fmt.Fprintf(state.ErrorStream, "\nPulling trivy image %v...\n\n", image)
+		if err := state.DockerClient.PullImage(image, state.ErrorStream); err != nil {
+			return fmt.Errorf("cdflow2: error pulling trivy image: %w", err)
+		}
 	}
+	trivyContainer, err := trivy.NewContainer(ctx, state.DockerClient, image, state.CodeDir, state.Manifest.Trivy.Params)
+	if err != nil {
+		return fmt.Errorf("cdflow2: error creating trivy container: %w", err)
+	}
+	defer func() {
+		if err := trivyContainer.Done(); err != nil {
+			if returnedError != nil {
+				returnedError = fmt.Errorf("%w, also %v", returnedError, err)
+			} else {
+				returnedError = err
+			}
+		}
+	}()
+
+	endPhase := state.Result.StartPhase("scan-infra")
+	findings, err := trivyContainer.ScanInfra(config.ConfigFiles(state, envName), state.ErrorStream)
+	endPhase()
+	if findings != nil {
+		fmt.Fprint(state.ErrorStream, "\ncdflow2: security findings...\n\n")
+		if err := trivy.WriteFindingsTable(state.ErrorStream, map[string]*trivy.Findings{"infra": findings}); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("cdflow2: error scanning infra: %w", err)
+	}
+	return nil
+}
 
-	envConfigFilename := path.Join(state.ConfigFilesFolder, envName+".json")
-	if _, err := os.Stat(envConfigFilename); !os.IsNotExist(err) {
-		command = append(command, "-var-file=../"+envConfigFilename)
+// AppendConfigFiles appends -var-file arguments for the common and environment config files that exist.
+func AppendConfigFiles(command []string, state *command.GlobalState, envName string) []string {
+	for _, configFile := range config.ConfigFiles(state, envName) {
+		command = append(command, "-var-file=../"+configFile)
 	}
 
 	command = append(command, "-var-file=/build/release-metadata.json")
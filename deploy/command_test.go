@@ -2,6 +2,7 @@ package deploy_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"reflect"
 	"strings"
@@ -60,7 +61,7 @@ func TestRunCommand(t *testing.T) {
 	args, _ := deploy.ParseArgs([]string{"test-env", "test-version"})
 
 	// When
-	if err := deploy.RunCommand(state, args, map[string]string{
+	if err := deploy.RunCommand(context.Background(), state, args, map[string]string{
 		"TERRAFORM_DIGEST": terraformDigest,
 	}); err != nil {
 		t.Fatal("error running deploy command:", err, errorBuffer.String())
@@ -200,7 +201,7 @@ func TestRunCommandPlanOnly(t *testing.T) {
 	args, _ := deploy.ParseArgs([]string{"--plan-only", "test-env", "test-version"})
 
 	// When
-	if err := deploy.RunCommand(state, args, map[string]string{
+	if err := deploy.RunCommand(context.Background(), state, args, map[string]string{
 		"TERRAFORM_DIGEST": terraformDigest,
 	}); err != nil {
 		t.Fatal("error running deploy command:", err, errorBuffer.String())
@@ -237,6 +238,9 @@ func TestParseArgs(t *testing.T) {
 		if gotArgs.PlanOnly != wantArgs.PlanOnly {
 			t.Errorf("PlanOnly: got %t want %t", gotArgs.PlanOnly, wantArgs.PlanOnly)
 		}
+		if gotArgs.Force != wantArgs.Force {
+			t.Errorf("Force: got %t want %t", gotArgs.Force, wantArgs.Force)
+		}
 	}
 	assertMatchState := func(t *testing.T, gotArgs, wantArgs *deploy.CommandArgs) {
 		t.Helper()
@@ -293,6 +297,37 @@ func TestParseArgs(t *testing.T) {
 		assertMatchError(t, err, false)
 	})
 
+	t.Run("set force + env + version", func(t *testing.T) {
+		args := []string{"-f", "foo", "bar"}
+		gotArgs, err := deploy.ParseArgs(args)
+
+		wantArgs := &deploy.CommandArgs{
+			EnvName: "foo",
+			Version: "bar",
+			Force:   true,
+		}
+
+		assertMatchArgs(t, gotArgs, wantArgs)
+		assertMatchError(t, err, false)
+	})
+
+	t.Run("force isn't defaulted from the environment", func(t *testing.T) {
+		t.Setenv("CDFLOW2_FORCE", "true")
+		gotArgs, err := deploy.ParseArgs([]string{"foo", "bar"})
+
+		assertMatchArgs(t, gotArgs, &deploy.CommandArgs{EnvName: "foo", Version: "bar"})
+		assertMatchError(t, err, false)
+	})
+
+	t.Run("set accept-findings + env + version", func(t *testing.T) {
+		gotArgs, err := deploy.ParseArgs([]string{"--accept-findings", "foo", "bar"})
+
+		assertMatchError(t, err, false)
+		if !gotArgs.AcceptFindings {
+			t.Error("AcceptFindings: got false want true")
+		}
+	})
+
 	t.Run("set plan-only + env + version + StateShouldExist", func(t *testing.T) {
 		args := []string{"-p", "foo", "bar"}
 		gotArgs, err := deploy.ParseArgs(args)
@@ -327,3 +362,52 @@ func TestParseArgs(t *testing.T) {
 		assertMatchError(t, err, false)
 	})
 }
+
+func TestCheckSecurityFindings(t *testing.T) {
+	failingRelease := []byte(`{"release": {"security_findings": "{\"builds\": {\"docker\": {\"counts\": {\"CRITICAL\": 1}, \"fail\": true}}}"}}`)
+	passingRelease := []byte(`{"release": {"security_findings": "{\"builds\": {\"docker\": {\"counts\": {\"LOW\": 1}, \"fail\": false}}}"}}`)
+	unscannedRelease := []byte(`{"release": {"version": "1"}}`)
+
+	newState := func() *command.GlobalState {
+		return &command.GlobalState{
+			ErrorStream:      &bytes.Buffer{},
+			Manifest:         &manifest.Manifest{ProtectedEnvironments: []string{"live"}},
+			MonitoringClient: monitoring.NewDatadogClient(),
+		}
+	}
+
+	t.Run("unprotected environment", func(t *testing.T) {
+		if err := deploy.CheckSecurityFindings(newState(), "aslive", failingRelease, false); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("no failing findings", func(t *testing.T) {
+		for _, release := range [][]byte{passingRelease, unscannedRelease} {
+			if err := deploy.CheckSecurityFindings(newState(), "live", release, false); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}
+	})
+
+	t.Run("failing findings", func(t *testing.T) {
+		state := newState()
+		err := deploy.CheckSecurityFindings(state, "live", failingRelease, false)
+		if err == nil || !strings.Contains(err.Error(), "--accept-findings") {
+			t.Errorf("expected error mentioning --accept-findings, got %v", err)
+		}
+		if !strings.Contains(state.ErrorStream.(*bytes.Buffer).String(), "docker") {
+			t.Error("expected findings table in output")
+		}
+	})
+
+	t.Run("failing findings accepted", func(t *testing.T) {
+		state := newState()
+		if err := deploy.CheckSecurityFindings(state, "live", failingRelease, true); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if state.MonitoringClient.ConfigData[deploy.MONITORING_ACCEPTED_FINDINGS] != "true" {
+			t.Error("expected accepted findings to be recorded in monitoring")
+		}
+	})
+}
@@ -1,14 +1,17 @@
 package destroy
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"strings"
 
 	"github.com/mergermarket/cdflow2/command"
 	"github.com/mergermarket/cdflow2/config"
+	"github.com/mergermarket/cdflow2/lock"
 	"github.com/mergermarket/cdflow2/terraform"
 	"github.com/mergermarket/cdflow2/util"
 )
@@ -20,6 +23,33 @@ type CommandArgs struct {
 	PlanOnly          bool
 	TerraformLogLevel string
 	StateShouldExist  *bool
+	Force             bool
+}
+
+// NewArgParser returns the parser for the destroy options and arguments, which sets result.
+func NewArgParser(result *CommandArgs) *command.ArgParser {
+	return &command.ArgParser{
+		Name: "destroy",
+		Options: []command.Option{
+			command.Flag("plan-only", "p", func() { result.PlanOnly = true }),
+			// never defaulted, so that overriding a lock is always an explicit choice
+			{Long: "force", Short: "f", NoDefault: true, Handle: func(string) error {
+				result.Force = true
+				return nil
+			}},
+			command.StringValue("terraform-log-level", "t", &result.TerraformLogLevel),
+		},
+		HandleArg: func(arg string) (bool, error) {
+			if result.EnvName == "" {
+				result.EnvName = arg
+			} else if result.Version == "" {
+				result.Version = arg
+			} else {
+				return false, errors.New("unknown destroy argument: " + arg)
+			}
+			return false, nil
+		},
+	}
 }
 
 // ParseArgs parses command line arguments to the deploy subcommand.
@@ -28,20 +58,9 @@ func ParseArgs(args []string) (*CommandArgs, error) {
 	var T = true
 	result.StateShouldExist = &T // set default to true
 
-	i := 0
-	take := func() (string, error) {
-		i++
-		if i >= len(args) {
-			return "", errors.New("missing value")
-		}
-
-		return args[i], nil
-	}
-	for ; i < len(args); i++ {
-		_, err := handleArgs(args[i], &result, take)
-		if err != nil {
-			return nil, err
-		}
+	parser := NewArgParser(&result)
+	if _, err := parser.Parse(args); err != nil {
+		return nil, err
 	}
 
 	if result.EnvName == "" {
@@ -55,38 +74,11 @@ func ParseArgs(args []string) (*CommandArgs, error) {
 	return &result, nil
 }
 
-func handleArgs(arg string, commandArgs *CommandArgs, take func() (string, error)) (bool, error) {
-	if strings.HasPrefix(arg, "-") {
-		return handleFlag(arg, commandArgs, take)
-	} else if commandArgs.EnvName == "" {
-		commandArgs.EnvName = arg
-	} else if commandArgs.Version == "" {
-		commandArgs.Version = arg
-	} else {
-		return false, errors.New("unknown destroy argument: " + arg)
-	}
-	return false, nil
-}
-
-func handleFlag(arg string, commandArgs *CommandArgs, take func() (string, error)) (bool, error) {
-	if arg == "-p" || arg == "--plan-only" {
-		commandArgs.PlanOnly = true
-	} else if arg == "-t" || arg == "--terraform-log-level" {
-		value, err := take()
-		if err != nil {
-			return false, err
-		}
-
-		commandArgs.TerraformLogLevel = value
-	} else {
-		return false, errors.New("unknown destroy option: " + arg)
-	}
-	return false, nil
-}
-
 // RunCommand runs the release command.
-func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]string) (returnedError error) {
-	prepareTerraformResponse, buildVolume, terraformImage, err := config.SetupTerraform(state, args.StateShouldExist, args.EnvName, args.Version, env)
+func RunCommand(ctx context.Context, state *command.GlobalState, args *CommandArgs, env map[string]string) (returnedError error) {
+	endPhase := state.Result.StartPhase("setup-terraform")
+	prepareTerraformResponse, buildVolume, terraformImage, err := config.SetupTerraform(ctx, state, args.StateShouldExist, args.EnvName, args.Version, env)
+	endPhase()
 	if err != nil {
 		return err
 	}
@@ -102,6 +94,7 @@ func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]st
 	}()
 
 	terraformContainer, err := terraform.NewContainer(
+		ctx,
 		state.DockerClient,
 		terraformImage,
 		state.CodeDir,
@@ -121,6 +114,7 @@ func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]st
 		}
 	}()
 
+	endPhase = state.Result.StartPhase("init")
 	if err := terraformContainer.CopyTerraformLockIfExists(state.OutputStream, state.ErrorStream); err != nil {
 		return err
 	}
@@ -128,6 +122,13 @@ func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]st
 	if err := terraformContainer.ConfigureBackend(state.OutputStream, state.ErrorStream, prepareTerraformResponse, true); err != nil {
 		return err
 	}
+	endPhase()
+
+	if !args.PlanOnly {
+		if err := lock.Check(ctx, state, args.EnvName, args.Force, env); err != nil {
+			return err
+		}
+	}
 
 	if err := terraformContainer.SwitchWorkspace(args.EnvName, state.OutputStream, state.ErrorStream); err != nil {
 		return err
@@ -173,12 +174,18 @@ func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]st
 		util.FormatCommand(strings.Join(planCommand, " ")),
 	)
 
+	var planBuff strings.Builder
+	endPhase = state.Result.StartPhase("plan")
 	if err := terraformContainer.RunCommand(
 		planCommand, prepareTerraformResponse.Env,
-		state.OutputStream, state.ErrorStream,
+		io.MultiWriter(state.OutputStream, &planBuff), state.ErrorStream,
 	); err != nil {
 		return err
 	}
+	endPhase()
+	if add, change, destroy, ok := terraform.GetPlanCounts(planBuff.String()); ok {
+		state.Result.SetPlan(add, change, destroy)
+	}
 
 	if args.PlanOnly {
 		return nil
@@ -191,12 +198,14 @@ func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]st
 		util.FormatCommand(strings.Join(destroyCommand, " ")),
 	)
 
+	endPhase = state.Result.StartPhase("destroy")
 	if err := terraformContainer.RunCommand(
 		destroyCommand, prepareTerraformResponse.Env,
 		state.OutputStream, state.ErrorStream,
 	); err != nil {
 		return err
 	}
+	endPhase()
 
 	return nil
 }
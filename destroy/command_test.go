@@ -18,6 +18,9 @@ func TestParseArgs(t *testing.T) {
 		if gotArgs.PlanOnly != wantArgs.PlanOnly {
 			t.Errorf("PlanOnly: got %t want %t", gotArgs.PlanOnly, wantArgs.PlanOnly)
 		}
+		if gotArgs.Force != wantArgs.Force {
+			t.Errorf("Force: got %t want %t", gotArgs.Force, wantArgs.Force)
+		}
 	}
 
 	assertMatchError := func(t *testing.T, err error, wantError bool) {
@@ -85,4 +88,26 @@ func TestParseArgs(t *testing.T) {
 		assertMatchArgs(t, gotArgs, wantArgs)
 		assertMatchError(t, err, false)
 	})
+
+	t.Run("set force + env + version", func(t *testing.T) {
+		args := []string{"--force", "foo", "bar"}
+		gotArgs, err := destroy.ParseArgs(args)
+
+		wantArgs := &destroy.CommandArgs{
+			EnvName: "foo",
+			Version: "bar",
+			Force:   true,
+		}
+
+		assertMatchArgs(t, gotArgs, wantArgs)
+		assertMatchError(t, err, false)
+	})
+
+	t.Run("force isn't defaulted from the environment", func(t *testing.T) {
+		t.Setenv("CDFLOW2_FORCE", "true")
+		gotArgs, err := destroy.ParseArgs([]string{"foo", "bar"})
+
+		assertMatchArgs(t, gotArgs, &destroy.CommandArgs{EnvName: "foo", Version: "bar"})
+		assertMatchError(t, err, false)
+	})
 }
@@ -0,0 +1,281 @@
+package diff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/mergermarket/cdflow2/command"
+	"github.com/mergermarket/cdflow2/config"
+)
+
+// CommandArgs contains specific arguments to the diff command.
+type CommandArgs struct {
+	VersionA string
+	VersionB string
+}
+
+// NewArgParser returns the parser for the diff options and arguments, which sets result.
+func NewArgParser(result *CommandArgs) *command.ArgParser {
+	return &command.ArgParser{
+		Name: "diff",
+		HandleArg: func(arg string) (bool, error) {
+			if result.VersionA == "" {
+				result.VersionA = arg
+			} else if result.VersionB == "" {
+				result.VersionB = arg
+			} else {
+				return false, errors.New("unknown diff argument: " + arg)
+			}
+			return false, nil
+		},
+	}
+}
+
+// ParseArgs parses command line arguments to the diff subcommand.
+func ParseArgs(args []string) (*CommandArgs, error) {
+	var result CommandArgs
+
+	parser := NewArgParser(&result)
+	if _, err := parser.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if result.VersionA == "" || result.VersionB == "" {
+		return nil, errors.New("two version arguments are required")
+	}
+
+	return &result, nil
+}
+
+// Release contains the parts of a release that are compared.
+type Release struct {
+	Version        string
+	Commit         string
+	TerraformImage string
+	Metadata       map[string]map[string]string
+	TerraformLock  string
+}
+
+// getRelease retrieves a stored release and the files saved with it through the config container.
+func getRelease(configContainer *config.Container, state *command.GlobalState, version string, env map[string]string) (*Release, error) {
+	params := state.Manifest.Config.Params
+
+	getReleaseResponse, err := configContainer.GetRelease(version, state.Component, params, env)
+	if err != nil {
+		return nil, err
+	}
+
+	terraformImage, err := configContainer.ReadReleaseFile(version, state.Component, "terraform-image", params, env)
+	if err != nil {
+		return nil, fmt.Errorf("error reading terraform image for %v: %w", version, err)
+	}
+
+	// the lock file is optional
+	terraformLock, err := configContainer.ReadReleaseFile(version, state.Component, ".terraform.lock.hcl", params, env)
+	if err != nil && !errors.Is(err, config.ErrReleaseFileNotFound) {
+		return nil, fmt.Errorf("error reading .terraform.lock.hcl for %v: %w", version, err)
+	}
+
+	return &Release{
+		Version:        version,
+		Commit:         getReleaseResponse.Release.Commit,
+		TerraformImage: strings.TrimSpace(string(terraformImage)),
+		Metadata:       getReleaseResponse.Release.Metadata,
+		TerraformLock:  string(terraformLock),
+	}, nil
+}
+
+// RunCommand runs the diff command.
+func RunCommand(ctx context.Context, state *command.GlobalState, args *CommandArgs, env map[string]string) (returnedError error) {
+	if err := config.Pull(state); err != nil {
+		return err
+	}
+
+	// output from the config container goes to stderr so that stdout only contains the diff
+	containerState := *state
+	containerState.OutputStream = state.ErrorStream
+
+	// releases are read from the release store, so no release volume is needed
+	configContainer, err := config.NewContainer(ctx, &containerState, state.Manifest.Config.Image, "")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := configContainer.Done(); err != nil {
+			if returnedError != nil {
+				returnedError = fmt.Errorf("%w, also %v", returnedError, err)
+			} else {
+				returnedError = err
+			}
+		}
+	}()
+
+	releaseA, err := getRelease(configContainer, state, args.VersionA, env)
+	if err != nil {
+		return err
+	}
+	releaseB, err := getRelease(configContainer, state, args.VersionB, env)
+	if err != nil {
+		return err
+	}
+
+	WriteDiff(state.OutputStream, releaseA, releaseB)
+
+	commitA := releaseA.Commit
+	commitB := releaseB.Commit
+	fmt.Fprintf(state.OutputStream, "\nCommits (%s..%s):\n", commitA, commitB)
+	if commitA == "" || commitB == "" {
+		fmt.Fprintln(state.OutputStream, "  commit not recorded in release")
+	} else if commitA == commitB {
+		fmt.Fprintln(state.OutputStream, "  (same commit)")
+	} else if log, err := gitLog(state.CodeDir, commitA, commitB); err != nil {
+		fmt.Fprintf(state.OutputStream, "  not available locally: %v\n", err)
+	} else {
+		fmt.Fprint(state.OutputStream, log)
+	}
+
+	return nil
+}
+
+func gitLog(codeDir, commitA, commitB string) (string, error) {
+	cmd := exec.Command("git", "log", "--oneline", commitA+".."+commitB)
+	cmd.Dir = codeDir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	var result strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line != "" {
+			result.WriteString("  " + line + "\n")
+		}
+	}
+	if result.Len() == 0 {
+		return "  no commits (" + commitB + " is an ancestor of " + commitA + ")\n", nil
+	}
+	return result.String(), nil
+}
+
+// WriteDiff writes a structured diff of two releases.
+func WriteDiff(outputStream io.Writer, releaseA, releaseB *Release) {
+	fmt.Fprintf(outputStream, "--- %s\n+++ %s\n", releaseA.Version, releaseB.Version)
+
+	fmt.Fprintln(outputStream, "\nTerraform image:")
+	if releaseA.TerraformImage == releaseB.TerraformImage {
+		fmt.Fprintf(outputStream, "  %s\n", releaseA.TerraformImage)
+	} else {
+		fmt.Fprintf(outputStream, "- %s\n+ %s\n", releaseA.TerraformImage, releaseB.TerraformImage)
+	}
+
+	fmt.Fprintln(outputStream, "\nRelease metadata:")
+	changes := DiffMetadata(releaseA.Metadata, releaseB.Metadata)
+	if len(changes) == 0 {
+		fmt.Fprintln(outputStream, "  (no changes)")
+	}
+	for _, change := range changes {
+		fmt.Fprintln(outputStream, change)
+	}
+
+	fmt.Fprintln(outputStream, "\n.terraform.lock.hcl:")
+	lines := DiffLines(releaseA.TerraformLock, releaseB.TerraformLock)
+	if len(lines) == 0 {
+		fmt.Fprintln(outputStream, "  (no changes)")
+	}
+	for _, line := range lines {
+		fmt.Fprintln(outputStream, line)
+	}
+}
+
+// DiffMetadata compares release metadata maps and returns a line for each added (+), removed (-) or changed (~) value.
+func DiffMetadata(a, b map[string]map[string]string) []string {
+	var result []string
+	for _, buildID := range unionKeys(a, b) {
+		buildA, inA := a[buildID]
+		buildB, inB := b[buildID]
+		keys := unionKeys(buildA, buildB)
+		if !inA {
+			result = append(result, "+ "+buildID)
+		} else if !inB {
+			result = append(result, "- "+buildID)
+		}
+		for _, key := range keys {
+			valueA, keyInA := buildA[key]
+			valueB, keyInB := buildB[key]
+			if !keyInA {
+				result = append(result, fmt.Sprintf("+ %s.%s: %s", buildID, key, valueB))
+			} else if !keyInB {
+				result = append(result, fmt.Sprintf("- %s.%s: %s", buildID, key, valueA))
+			} else if valueA != valueB {
+				result = append(result, fmt.Sprintf("~ %s.%s: %s -> %s", buildID, key, valueA, valueB))
+			}
+		}
+	}
+	return result
+}
+
+func unionKeys[V any](a, b map[string]V) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, m := range []map[string]V{a, b} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DiffLines returns the lines removed (-) and added (+) between two texts, based on their longest common subsequence.
+func DiffLines(a, b string) []string {
+	linesA := splitLines(a)
+	linesB := splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of linesA[i:] and linesB[j:]
+	lcs := make([][]int, len(linesA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(linesB)+1)
+	}
+	for i := len(linesA) - 1; i >= 0; i-- {
+		for j := len(linesB) - 1; j >= 0; j-- {
+			if linesA[i] == linesB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var result []string
+	i, j := 0, 0
+	for i < len(linesA) || j < len(linesB) {
+		if i < len(linesA) && j < len(linesB) && linesA[i] == linesB[j] {
+			i++
+			j++
+		} else if j == len(linesB) || (i < len(linesA) && lcs[i+1][j] >= lcs[i][j+1]) {
+			result = append(result, "- "+linesA[i])
+			i++
+		} else {
+			result = append(result, "+ "+linesB[j])
+			j++
+		}
+	}
+	return result
+}
+
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
@@ -0,0 +1,90 @@
+package diff_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/diff"
+)
+
+func TestParseArgs(t *testing.T) {
+	args, err := diff.ParseArgs([]string{"1", "2"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if !reflect.DeepEqual(args, &diff.CommandArgs{VersionA: "1", VersionB: "2"}) {
+		t.Errorf("unexpected args: %+v", args)
+	}
+
+	for name, args := range map[string][]string{
+		"no args":        {},
+		"one version":    {"1"},
+		"too many args":  {"1", "2", "3"},
+		"unknown option": {"--foo", "1", "2"},
+	} {
+		t.Run("sad path - "+name, func(t *testing.T) {
+			if _, err := diff.ParseArgs(args); err == nil {
+				t.Error("Error expected, but got nil")
+			}
+		})
+	}
+}
+
+func TestDiffMetadata(t *testing.T) {
+	got := diff.DiffMetadata(
+		map[string]map[string]string{
+			"release": {"version": "1", "commit": "aaa"},
+			"docker":  {"image": "repo@sha256:1", "old": "x"},
+			"lambda":  {"key": "a.zip"},
+		},
+		map[string]map[string]string{
+			"release": {"version": "2", "commit": "aaa"},
+			"docker":  {"image": "repo@sha256:2", "new": "y"},
+		},
+	)
+	want := []string{
+		"~ docker.image: repo@sha256:1 -> repo@sha256:2",
+		"+ docker.new: y",
+		"- docker.old: x",
+		"- lambda",
+		"- lambda.key: a.zip",
+		"~ release.version: 1 -> 2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	got := diff.DiffLines("a\nb\nc\n", "a\nc\nd\n")
+	want := []string{"- b", "+ d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	if got := diff.DiffLines("same\n", "same\n"); len(got) != 0 {
+		t.Errorf("expected no changes, got %q", got)
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	var output bytes.Buffer
+	diff.WriteDiff(&output, &diff.Release{
+		Version:        "1",
+		TerraformImage: "terraform@sha256:1",
+		Metadata:       map[string]map[string]string{"release": {"version": "1"}},
+	}, &diff.Release{
+		Version:        "2",
+		TerraformImage: "terraform@sha256:1",
+		Metadata:       map[string]map[string]string{"release": {"version": "2"}},
+		TerraformLock:  "provider \"aws\" {}\n",
+	})
+	expected := "--- 1\n+++ 2\n" +
+		"\nTerraform image:\n  terraform@sha256:1\n" +
+		"\nRelease metadata:\n~ release.version: 1 -> 2\n" +
+		"\n.terraform.lock.hcl:\n+ provider \"aws\" {}\n"
+	if output.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", output.String(), expected)
+	}
+}
@@ -1,17 +1,30 @@
 package docker
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"time"
+)
+
+const (
+	// LabelRunID is the label on containers and volumes created by cdflow2 containing the ID of the run that created them.
+	LabelRunID = "com.mergermarket.cdflow2.run-id"
+	// LabelPID is the label containing the process ID of the cdflow2 process that created the container or volume.
+	LabelPID = "com.mergermarket.cdflow2.pid"
+	// LabelHostname is the label containing the hostname of the machine the cdflow2 process was running on.
+	LabelHostname = "com.mergermarket.cdflow2.hostname"
 )
 
 // Iface is an interface for interracting with docker.
 type Iface interface {
-	Run(options *RunOptions) error
+	Run(ctx context.Context, options *RunOptions) error
 	EnsureImage(image string, outputStream io.Writer) error
 	PullImage(image string, outputStream io.Writer) error
 	GetImageRepoDigests(image string) ([]string, error)
-	Exec(options *ExecOptions) error
-	Stop(id string, timeout int) error
+	GetImageLabels(image string) (map[string]string, error)
+	Exec(ctx context.Context, options *ExecOptions) error
+	Stop(ctx context.Context, id string, timeout int) error
 	CreateVolume(name string) (string, error)
 	VolumeExists(name string) (bool, error)
 	RemoveVolume(id string) error
@@ -20,6 +33,19 @@ type Iface interface {
 	CopyFromContainer(id, path string) (io.ReadCloser, error)
 	CopyToContainer(id, path string, reader io.Reader) error
 	SetDebugVolume(volume string)
+	ListContainers() ([]*Resource, error)
+	ListVolumes() ([]*Resource, error)
+}
+
+// Resource is a container or volume labelled as created by cdflow2.
+type Resource struct {
+	ID       string
+	Name     string
+	Created  time.Time
+	Running  bool
+	RunID    string
+	PID      int
+	Hostname string
 }
 
 // RunOptions represents the options to the Run method.
@@ -57,4 +83,17 @@ type ExecOptions struct {
 	Tty          bool
 	Interactive  bool
 	WorkingDir   string
+	// InterruptCmd is run in the container if the context is cancelled, to ask the exec'd process to exit (e.g. by sending it SIGINT).
+	InterruptCmd []string
+	// InterruptTimeout is how long to wait for the exec'd process to exit after InterruptCmd has been run.
+	InterruptTimeout time.Duration
+}
+
+// ExitError is returned by Exec when the exec'd process exits with a non-zero status code.
+type ExitError struct {
+	ExitCode int
+}
+
+func (exitError *ExitError) Error() string {
+	return fmt.Sprintf("exec process exited with error status code %d", exitError.ExitCode)
 }
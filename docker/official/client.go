@@ -8,15 +8,19 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/rs/xid"
 	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/mergermarket/cdflow2/docker"
@@ -27,12 +31,15 @@ const (
 	cdflowDockerAuthPrefix = "CDFLOW2_DOCKER_AUTH_"
 	// Docker Hub's default index hostname
 	dockerIndexHostname = "index.docker.io"
+	// seconds a container started by Run is given to exit when its context is cancelled
+	containerStopTimeout = 10
 )
 
 // Client is a concrete implementation of our docker interface that uses the official client library.
 type Client struct {
 	client      *client.Client
 	debugVolume string
+	labels      map[string]string
 }
 
 // NewClient creates and returns a new client.
@@ -41,18 +48,35 @@ func NewClient() (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	hostname, _ := os.Hostname() // best effort, it's only used to find leftover containers and volumes
 	return &Client{
 		client: client,
+		labels: map[string]string{
+			docker.LabelRunID:    xid.New().String(),
+			docker.LabelPID:      strconv.Itoa(os.Getpid()),
+			docker.LabelHostname: hostname,
+		},
 	}, nil
 }
 
+// Ping checks that the docker daemon can be reached, returning the API version of the daemon and the API version
+// the client negotiated to use with it.
+func (dockerClient *Client) Ping() (serverVersion, clientVersion string, err error) {
+	ping, err := dockerClient.client.Ping(context.Background())
+	if err != nil {
+		return "", "", err
+	}
+	dockerClient.client.NegotiateAPIVersionPing(ping)
+	return ping.APIVersion, dockerClient.client.ClientVersion(), nil
+}
+
 // SetDebugVolume sets a volume that will be mapped to /debug in each container, for an out of band way to get data out for testing.
 func (dockerClient *Client) SetDebugVolume(volume string) {
 	dockerClient.debugVolume = volume
 }
 
-// Run runs a container (much like `docker run` in the cli).
-func (dockerClient *Client) Run(options *docker.RunOptions) error {
+// Run runs a container (much like `docker run` in the cli). If the context is cancelled the container is stopped.
+func (dockerClient *Client) Run(ctx context.Context, options *docker.RunOptions) error {
 	stdin := false
 	if options.InputStream != nil {
 		stdin = true
@@ -62,7 +86,7 @@ func (dockerClient *Client) Run(options *docker.RunOptions) error {
 		binds = append(binds, dockerClient.debugVolume+":/debug")
 	}
 	response, err := dockerClient.client.ContainerCreate(
-		context.Background(),
+		ctx,
 		&container.Config{
 			Image:        options.Image,
 			OpenStdin:    stdin,
@@ -73,6 +97,7 @@ func (dockerClient *Client) Run(options *docker.RunOptions) error {
 			Entrypoint:   options.Entrypoint,
 			Cmd:          options.Cmd,
 			Env:          options.Env,
+			Labels:       dockerClient.labels,
 		},
 		&container.HostConfig{
 			LogConfig: container.LogConfig{Type: "none"},
@@ -89,6 +114,17 @@ func (dockerClient *Client) Run(options *docker.RunOptions) error {
 
 	statusChannel := dockerClient.waitForContainerExit(response.ID)
 
+	stopOnCancel := make(chan struct{})
+	defer close(stopOnCancel)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// the context is already cancelled, so stop with one that isn't
+			_ = dockerClient.Stop(context.WithoutCancel(ctx), response.ID, containerStopTimeout)
+		case <-stopOnCancel:
+		}
+	}()
+
 	if err := dockerClient.runContainer(response.ID, options.InputStream, options.OutputStream, options.ErrorStream, options.Started); err != nil {
 		return err
 	}
@@ -98,11 +134,14 @@ func (dockerClient *Client) Run(options *docker.RunOptions) error {
 		return err
 	}
 
-	if status.exitCode != options.SuccessStatus {
+	if status.exitCode != options.SuccessStatus || ctx.Err() != nil {
 		extra := ""
 		if err := dockerClient.RemoveContainer(response.ID); err != nil {
 			extra = "\nerror removing container: " + err.Error()
 		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("container stopped: %w%s", ctx.Err(), extra)
+		}
 		return fmt.Errorf("container exited with unsuccessful exit code %d%s", status.exitCode, extra)
 	}
 
@@ -242,13 +281,15 @@ func getRegistryAuth(image string, outputStream io.Writer) (string, error) {
 	return base64.URLEncoding.EncodeToString(authBytes), nil
 }
 
-func getRegistryCredentials(image string) (username, password string, err error) {
+// registryCredentialsVars returns the names of the environment variables that credentials for the registry of an image
+// are read from.
+func registryCredentialsVars(image string) (usernameVar, passwordVar string, err error) {
 	named, err := reference.ParseNormalizedNamed(image)
 	if err != nil {
 		return "", "", err
 	}
 
-	imageRegistry := strings.ToUpper(
+	prefix := cdflowDockerAuthPrefix + strings.ToUpper(
 		strings.NewReplacer(
 			".", "_",
 			":", "_",
@@ -256,7 +297,31 @@ func getRegistryCredentials(image string) (username, password string, err error)
 		).Replace(reference.Domain(named)),
 	)
 
-	return os.Getenv(cdflowDockerAuthPrefix + imageRegistry + "_USERNAME"), os.Getenv(cdflowDockerAuthPrefix + imageRegistry + "_PASSWORD"), nil
+	return prefix + "_USERNAME", prefix + "_PASSWORD", nil
+}
+
+func getRegistryCredentials(image string) (username, password string, err error) {
+	usernameVar, passwordVar, err := registryCredentialsVars(image)
+	if err != nil {
+		return "", "", err
+	}
+
+	return os.Getenv(usernameVar), os.Getenv(passwordVar), nil
+}
+
+// CheckRegistryCredentials returns the names of the environment variables that credentials for the registry of an
+// image are read from, and whether credentials were found (either there or in the legacy variables).
+func CheckRegistryCredentials(image string) (usernameVar, passwordVar string, found bool, err error) {
+	usernameVar, passwordVar, err = registryCredentialsVars(image)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	username, password := os.Getenv(usernameVar), os.Getenv(passwordVar)
+	if username == "" || password == "" {
+		username, password = getRegistryCredentialsLegacy(image)
+	}
+	return usernameVar, passwordVar, username != "" && password != "", nil
 }
 
 func getRegistryCredentialsLegacy(image string) (username, password string) {
@@ -306,8 +371,22 @@ func (dockerClient *Client) GetImageRepoDigests(image string) ([]string, error)
 	return details.RepoDigests, nil
 }
 
-// Exec execs a process in a docker container (like `docker exec` in the cli).
-func (dockerClient *Client) Exec(options *docker.ExecOptions) error {
+// GetImageLabels returns the labels of a local image.
+func (dockerClient *Client) GetImageLabels(image string) (map[string]string, error) {
+	details, _, err := dockerClient.client.ImageInspectWithRaw(context.Background(), image)
+	if err != nil {
+		return nil, err
+	}
+	if details.Config == nil {
+		return nil, nil
+	}
+	return details.Config.Labels, nil
+}
+
+// Exec execs a process in a docker container (like `docker exec` in the cli). If the context is cancelled then
+// options.InterruptCmd is run in the container and the process is given options.InterruptTimeout to exit before
+// Exec gives up on it, returning an error either way.
+func (dockerClient *Client) Exec(ctx context.Context, options *docker.ExecOptions) error {
 	stdin := false
 	if options.InputStream != nil {
 		stdin = true
@@ -370,16 +449,26 @@ func (dockerClient *Client) Exec(options *docker.ExecOptions) error {
 		defer func() { _ = terminal.Restore(int(os.Stdin.Fd()), oldState) }()
 	}
 
-	if err := dockerClient.streamHijackedResponse(
-		attachResponse,
-		options.InputStream,
-		options.OutputStream,
-		options.ErrorStream,
-		func() error {
-			return nil
-		},
-	); err != nil {
-		return fmt.Errorf("error streaming data from exec: %w", err)
+	streamed := make(chan error, 1)
+	go func() {
+		streamed <- dockerClient.streamHijackedResponse(
+			attachResponse,
+			options.InputStream,
+			options.OutputStream,
+			options.ErrorStream,
+			func() error {
+				return nil
+			},
+		)
+	}()
+
+	select {
+	case err := <-streamed:
+		if err != nil {
+			return fmt.Errorf("error streaming data from exec: %w", err)
+		}
+	case <-ctx.Done():
+		return dockerClient.interruptExec(ctx, options, streamed)
 	}
 
 	details, err := dockerClient.client.ContainerExecInspect(
@@ -391,22 +480,48 @@ func (dockerClient *Client) Exec(options *docker.ExecOptions) error {
 	}
 
 	if details.ExitCode != 0 {
-		return fmt.Errorf("exec process exited with error status code %d", details.ExitCode)
+		return &docker.ExitError{ExitCode: details.ExitCode}
 	}
 
 	return nil
 }
 
+// interruptExec runs the interrupt command for an exec whose context has been cancelled and waits a bounded time for
+// it to finish streaming. An error is always returned so that the caller doesn't carry on as if nothing happened.
+func (dockerClient *Client) interruptExec(ctx context.Context, options *docker.ExecOptions, streamed chan error) error {
+	if len(options.InterruptCmd) == 0 {
+		return fmt.Errorf("exec interrupted: %w", ctx.Err())
+	}
+	if err := dockerClient.Exec(context.WithoutCancel(ctx), &docker.ExecOptions{
+		ID:           options.ID,
+		Cmd:          options.InterruptCmd,
+		OutputStream: io.Discard,
+		ErrorStream:  options.ErrorStream,
+	}); err != nil {
+		return fmt.Errorf("exec interrupted: %w (also unable to interrupt process: %v)", ctx.Err(), err)
+	}
+	select {
+	case <-streamed:
+		return fmt.Errorf("exec interrupted: %w", ctx.Err())
+	case <-time.After(options.InterruptTimeout):
+		return fmt.Errorf("exec interrupted: %w (process did not exit within %v)", ctx.Err(), options.InterruptTimeout)
+	}
+}
+
 // Stop stops a container.
-func (dockerClient *Client) Stop(id string, timeout int) error {
-	return dockerClient.client.ContainerStop(context.Background(), id, container.StopOptions{Timeout: &timeout})
+func (dockerClient *Client) Stop(ctx context.Context, id string, timeout int) error {
+	return dockerClient.client.ContainerStop(ctx, id, container.StopOptions{Timeout: &timeout})
 }
 
 // CreateVolume creates a docker volume and returns its ID.
 func (dockerClient *Client) CreateVolume(name string) (string, error) {
-	volume, err := dockerClient.client.VolumeCreate(context.Background(), volume.CreateOptions{
+	options := volume.CreateOptions{
 		Name: name,
-	})
+	}
+	if name == "" { // named volumes (i.e. the cache) are intended to outlive the run, so aren't labelled
+		options.Labels = dockerClient.labels
+	}
+	volume, err := dockerClient.client.VolumeCreate(context.Background(), options)
 	if err != nil {
 		return "", err
 	}
@@ -435,7 +550,8 @@ func (dockerClient *Client) CreateContainer(options *docker.CreateContainerOptio
 	container, err := dockerClient.client.ContainerCreate(
 		context.Background(),
 		&container.Config{
-			Image: options.Image,
+			Image:  options.Image,
+			Labels: dockerClient.labels,
 		},
 		&container.HostConfig{
 			Binds: options.Binds,
@@ -450,6 +566,57 @@ func (dockerClient *Client) CreateContainer(options *docker.CreateContainerOptio
 	return container.ID, nil
 }
 
+func resourceFromLabels(id, name string, created time.Time, running bool, labels map[string]string) *docker.Resource {
+	pid, _ := strconv.Atoi(labels[docker.LabelPID])
+	return &docker.Resource{
+		ID:       id,
+		Name:     name,
+		Created:  created,
+		Running:  running,
+		RunID:    labels[docker.LabelRunID],
+		PID:      pid,
+		Hostname: labels[docker.LabelHostname],
+	}
+}
+
+// ListContainers lists all containers (running or not) labelled as created by cdflow2.
+func (dockerClient *Client) ListContainers() ([]*docker.Resource, error) {
+	containers, err := dockerClient.client.ContainerList(context.Background(), container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", docker.LabelRunID)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result []*docker.Resource
+	for _, container := range containers {
+		name := container.ID
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		result = append(result, resourceFromLabels(
+			container.ID, name, time.Unix(container.Created, 0), container.State == "running", container.Labels,
+		))
+	}
+	return result, nil
+}
+
+// ListVolumes lists all volumes labelled as created by cdflow2.
+func (dockerClient *Client) ListVolumes() ([]*docker.Resource, error) {
+	response, err := dockerClient.client.VolumeList(context.Background(), volume.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", docker.LabelRunID)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result []*docker.Resource
+	for _, volume := range response.Volumes {
+		created, _ := time.Parse(time.RFC3339, volume.CreatedAt) // zero time (i.e. old) if missing
+		result = append(result, resourceFromLabels(volume.Name, volume.Name, created, false, volume.Labels))
+	}
+	return result, nil
+}
+
 // RemoveContainer removes a docker container.
 func (dockerClient *Client) RemoveContainer(id string) error {
 	return dockerClient.client.ContainerRemove(context.Background(), id, types.ContainerRemoveOptions{RemoveVolumes: true})
@@ -2,6 +2,7 @@ package official_test
 
 import (
 	"bytes"
+	"context"
 	"log"
 	"testing"
 
@@ -25,7 +26,7 @@ func TestRun(t *testing.T) {
 	}
 
 	// When
-	if err := dockerClient.Run(&docker.RunOptions{
+	if err := dockerClient.Run(context.Background(), &docker.RunOptions{
 		Image:        image,
 		OutputStream: &outputBuffer,
 		ErrorStream:  &errorBuffer,
@@ -48,3 +49,31 @@ func TestRun(t *testing.T) {
 		log.Panicf("unexpected output: %#v", outputBuffer.String())
 	}
 }
+
+func TestCheckRegistryCredentials(t *testing.T) {
+	t.Setenv("CDFLOW2_DOCKER_AUTH_123456789_DKR_ECR_EU_WEST_1_AMAZONAWS_COM_USERNAME", "user")
+	t.Setenv("CDFLOW2_DOCKER_AUTH_123456789_DKR_ECR_EU_WEST_1_AMAZONAWS_COM_PASSWORD", "pass")
+
+	usernameVar, passwordVar, found, err := official.CheckRegistryCredentials("123456789.dkr.ecr.eu-west-1.amazonaws.com/my-image:latest")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if !found {
+		t.Error("expected credentials to be found")
+	}
+	if usernameVar != "CDFLOW2_DOCKER_AUTH_123456789_DKR_ECR_EU_WEST_1_AMAZONAWS_COM_USERNAME" ||
+		passwordVar != "CDFLOW2_DOCKER_AUTH_123456789_DKR_ECR_EU_WEST_1_AMAZONAWS_COM_PASSWORD" {
+		t.Errorf("unexpected variable names: %s %s", usernameVar, passwordVar)
+	}
+
+	usernameVar, _, found, err = official.CheckRegistryCredentials("alpine:latest")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found {
+		t.Error("expected no credentials for docker hub")
+	}
+	if usernameVar != "CDFLOW2_DOCKER_AUTH_DOCKER_IO_USERNAME" {
+		t.Errorf("unexpected username variable: %s", usernameVar)
+	}
+}
@@ -11,10 +11,21 @@ export default {
       'Setup', 
       'Init',
       'Release',
+      'Releases',
+      'Diff',
       'Deploy',
+      'Rollback',
+      'Drift',
       'Destroy',
+      'Lock',
       'Common Terraform Setup',
-      'Shell'
+      'Shell',
+      'Output',
+      'Validate',
+      'Doctor',
+      'Clean',
+      'Config',
+      'Completion'
     ] },
     'cdflow.yaml Reference',
     'Design'
@@ -0,0 +1,216 @@
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/mergermarket/cdflow2/command"
+	"github.com/mergermarket/cdflow2/docker/official"
+	"github.com/mergermarket/cdflow2/manifest"
+	"github.com/mergermarket/cdflow2/util"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	// Pass means the check succeeded.
+	Pass Status = "PASS"
+	// Warn means the check found something that may be a problem.
+	Warn Status = "WARN"
+	// Fail means the check found a problem.
+	Fail Status = "FAIL"
+)
+
+// Check is the result of a single diagnostic check.
+type Check struct {
+	Name   string
+	Status Status
+	Detail string
+	Hint   string
+}
+
+// ParseArgs parses command line arguments to the doctor subcommand.
+func ParseArgs(args []string) error {
+	if len(args) != 0 {
+		return errors.New("doctor has no arguments")
+	}
+	return nil
+}
+
+func checkDocker() (*official.Client, []Check) {
+	dockerClient, err := official.NewClient()
+	if err != nil {
+		return nil, []Check{{
+			Name:   "docker client",
+			Status: Fail,
+			Detail: err.Error(),
+			Hint:   "check the DOCKER_HOST, DOCKER_API_VERSION, DOCKER_CERT_PATH and DOCKER_TLS_VERIFY environment variables",
+		}}
+	}
+
+	serverVersion, clientVersion, err := dockerClient.Ping()
+	if err != nil {
+		return nil, []Check{{
+			Name:   "docker daemon",
+			Status: Fail,
+			Detail: err.Error(),
+			Hint:   "make sure docker is running and you have permission to use it (e.g. access to /var/run/docker.sock), or set DOCKER_HOST",
+		}}
+	}
+	return dockerClient, []Check{{
+		Name:   "docker daemon",
+		Status: Pass,
+		Detail: fmt.Sprintf("reachable, daemon API version %s, using API version %s", serverVersion, clientVersion),
+	}}
+}
+
+func checkGit(globalArgs *command.GlobalArgs) []Check {
+	var checks []Check
+
+	if globalArgs.Component != "" {
+		checks = append(checks, Check{Name: "component", Status: Pass, Detail: globalArgs.Component + " (from --component)"})
+	} else if component, err := command.GetComponentFromGit(); err != nil {
+		checks = append(checks, Check{
+			Name:   "component",
+			Status: Fail,
+			Detail: "could not get the component name from the git remote",
+			Hint:   "add a remote with `git remote add origin URL`, or pass the --component global option",
+		})
+	} else {
+		checks = append(checks, Check{Name: "component", Status: Pass, Detail: component + " (from git remote origin)"})
+	}
+
+	if globalArgs.Commit != "" {
+		checks = append(checks, Check{Name: "commit", Status: Pass, Detail: globalArgs.Commit + " (from --commit)"})
+	} else if commit, err := command.GetCommitFromGit(); err != nil {
+		checks = append(checks, Check{
+			Name:   "commit",
+			Status: Fail,
+			Detail: "could not get the current commit from git",
+			Hint:   "run cdflow2 from within a git repository with at least one commit, or pass the --commit global option",
+		})
+	} else {
+		checks = append(checks, Check{Name: "commit", Status: Pass, Detail: commit})
+	}
+
+	return checks
+}
+
+// ManifestImages returns the images used in cdflow.yaml, keyed by where they are configured.
+func ManifestImages(loadedManifest *manifest.Manifest) map[string]string {
+	images := map[string]string{
+		"config":    loadedManifest.Config.Image,
+		"terraform": loadedManifest.Terraform.Image,
+	}
+	if loadedManifest.Trivy.Image != "" {
+		images["trivy"] = loadedManifest.Trivy.Image
+	}
+	for buildID, build := range loadedManifest.Builds {
+		images["builds > "+buildID] = build.Image
+	}
+	return images
+}
+
+// CheckRegistryCredentials checks whether registry credentials are available for each image.
+func CheckRegistryCredentials(images map[string]string) []Check {
+	keys := make([]string, 0, len(images))
+	for key := range images {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var checks []Check
+	for _, key := range keys {
+		image := images[key]
+		name := "registry credentials for " + key
+		usernameVar, passwordVar, found, err := official.CheckRegistryCredentials(image)
+		if err != nil {
+			checks = append(checks, Check{
+				Name:   name,
+				Status: Fail,
+				Detail: fmt.Sprintf("%q is not a valid image reference: %v", image, err),
+				Hint:   "fix the image in cdflow.yaml (see cdflow2 validate)",
+			})
+		} else if found {
+			checks = append(checks, Check{Name: name, Status: Pass, Detail: "found for " + image})
+		} else {
+			checks = append(checks, Check{
+				Name:   name,
+				Status: Warn,
+				Detail: "none found for " + image,
+				Hint:   fmt.Sprintf("this is fine for public images, otherwise set %s and %s", usernameVar, passwordVar),
+			})
+		}
+	}
+	return checks
+}
+
+func checkCacheVolume(dockerClient *official.Client) Check {
+	exists, err := dockerClient.VolumeExists("cdflow2-cache")
+	if err == nil && exists {
+		return Check{Name: "cache volume", Status: Pass, Detail: "cdflow2-cache exists"}
+	}
+	if _, err := util.GetCacheVolume(dockerClient); err != nil {
+		return Check{
+			Name:   "cache volume",
+			Status: Fail,
+			Detail: err.Error(),
+			Hint:   "check that you can create volumes with `docker volume create cdflow2-cache`",
+		}
+	}
+	return Check{Name: "cache volume", Status: Pass, Detail: "cdflow2-cache was missing and has been created"}
+}
+
+// WriteChecks writes a checklist of the results, returning true if any check failed.
+func WriteChecks(outputStream io.Writer, checks []Check) bool {
+	failed := false
+	for _, check := range checks {
+		fmt.Fprintf(outputStream, "[%s] %s", check.Status, check.Name)
+		if check.Detail != "" {
+			fmt.Fprintf(outputStream, ": %s", check.Detail)
+		}
+		fmt.Fprintln(outputStream)
+		if check.Hint != "" && check.Status != Pass {
+			fmt.Fprintf(outputStream, "       hint: %s\n", check.Hint)
+		}
+		if check.Status == Fail {
+			failed = true
+		}
+	}
+	return failed
+}
+
+// RunCommand runs the doctor command.
+func RunCommand(state *command.GlobalState) error {
+	dockerClient, checks := checkDocker()
+
+	loadedManifest, err := manifest.Load(state.CodeDir)
+	if err != nil {
+		checks = append(checks, Check{
+			Name:   "cdflow.yaml",
+			Status: Fail,
+			Detail: err.Error(),
+			Hint:   "run cdflow2 from the root of your project, and see cdflow2 validate for more detail",
+		})
+	} else {
+		checks = append(checks, Check{Name: "cdflow.yaml", Status: Pass, Detail: "loaded"})
+	}
+
+	checks = append(checks, checkGit(state.GlobalArgs)...)
+
+	if loadedManifest != nil {
+		checks = append(checks, CheckRegistryCredentials(ManifestImages(loadedManifest))...)
+	}
+
+	if dockerClient != nil {
+		checks = append(checks, checkCacheVolume(dockerClient))
+	}
+
+	if WriteChecks(state.OutputStream, checks) {
+		return command.Failure(1)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package doctor_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/doctor"
+	"github.com/mergermarket/cdflow2/manifest"
+)
+
+func TestManifestImages(t *testing.T) {
+	images := doctor.ManifestImages(&manifest.Manifest{
+		Config:    manifest.ImageWithParams{Image: "config-image"},
+		Terraform: manifest.Terraform{Image: "terraform-image"},
+		Builds: map[string]manifest.ImageWithParamsAndEnvVars{
+			"docker": {Image: "build-image"},
+		},
+	})
+	if !reflect.DeepEqual(images, map[string]string{
+		"config":          "config-image",
+		"terraform":       "terraform-image",
+		"builds > docker": "build-image",
+	}) {
+		t.Errorf("unexpected images: %v", images)
+	}
+}
+
+func TestCheckRegistryCredentials(t *testing.T) {
+	t.Setenv("CDFLOW2_DOCKER_AUTH_REGISTRY_EXAMPLE_COM_USERNAME", "user")
+	t.Setenv("CDFLOW2_DOCKER_AUTH_REGISTRY_EXAMPLE_COM_PASSWORD", "pass")
+
+	checks := doctor.CheckRegistryCredentials(map[string]string{
+		"config":    "registry.example.com/config:latest",
+		"terraform": "hashicorp/terraform:1.5.0",
+		"trivy":     "Not Valid",
+	})
+
+	statuses := []doctor.Status{}
+	for _, check := range checks {
+		statuses = append(statuses, check.Status)
+	}
+	if !reflect.DeepEqual(statuses, []doctor.Status{doctor.Pass, doctor.Warn, doctor.Fail}) {
+		t.Errorf("unexpected statuses: %v", checks)
+	}
+}
+
+func TestWriteChecks(t *testing.T) {
+	var output bytes.Buffer
+	failed := doctor.WriteChecks(&output, []doctor.Check{
+		{Name: "one", Status: doctor.Pass, Detail: "ok", Hint: "not shown"},
+		{Name: "two", Status: doctor.Fail, Detail: "broken", Hint: "fix it"},
+	})
+	if !failed {
+		t.Error("expected failure to be reported")
+	}
+	expected := "[PASS] one: ok\n[FAIL] two: broken\n       hint: fix it\n"
+	if output.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", output.String(), expected)
+	}
+}
@@ -0,0 +1,185 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mergermarket/cdflow2/command"
+	"github.com/mergermarket/cdflow2/config"
+	"github.com/mergermarket/cdflow2/deploy"
+	"github.com/mergermarket/cdflow2/docker"
+	"github.com/mergermarket/cdflow2/terraform"
+	"github.com/mergermarket/cdflow2/util"
+)
+
+// terraform plan -detailed-exitcode exits with this status when there are changes
+const driftExitCode = 2
+
+// CommandArgs contains specific arguments to the drift command.
+type CommandArgs struct {
+	EnvName           string
+	Version           string
+	TerraformLogLevel string
+}
+
+// NewArgParser returns the parser for the drift options and arguments, which sets result.
+func NewArgParser(result *CommandArgs) *command.ArgParser {
+	return &command.ArgParser{
+		Name: "drift",
+		Options: []command.Option{
+			command.StringValue("terraform-log-level", "t", &result.TerraformLogLevel),
+		},
+		HandleArg: func(arg string) (bool, error) {
+			if result.EnvName == "" {
+				result.EnvName = arg
+			} else if result.Version == "" {
+				result.Version = arg
+			} else {
+				return false, errors.New("unknown drift argument: " + arg)
+			}
+			return false, nil
+		},
+	}
+}
+
+// ParseArgs parses command line arguments to the drift subcommand.
+func ParseArgs(args []string) (*CommandArgs, error) {
+	var result CommandArgs
+
+	parser := NewArgParser(&result)
+	if _, err := parser.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if result.EnvName == "" {
+		return nil, errors.New("env argument is missing")
+	}
+
+	if result.Version == "" {
+		return nil, errors.New("version argument is missing")
+	}
+
+	return &result, nil
+}
+
+// Summary is the machine readable result of checking for drift.
+type Summary struct {
+	Drift           bool                       `json:"drift"`
+	ResourceChanges []terraform.ResourceChange `json:"resource_changes"`
+	OutputChanges   []string                   `json:"output_changes"`
+}
+
+// WriteSummary writes the summary as JSON.
+func WriteSummary(outputStream io.Writer, summary *Summary) error {
+	encoder := json.NewEncoder(outputStream)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(summary)
+}
+
+// RunCommand runs the drift command, returning command.Failure(2) if drift was found.
+func RunCommand(ctx context.Context, state *command.GlobalState, args *CommandArgs, env map[string]string) (returnedError error) {
+	// everything apart from the summary goes to stderr so that stdout can be parsed
+	setupState := *state
+	setupState.OutputStream = state.ErrorStream
+
+	stateShouldExist := true
+	prepareTerraformResponse, buildVolume, terraformImage, err := config.SetupTerraform(ctx, &setupState, &stateShouldExist, args.EnvName, args.Version, env)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := state.DockerClient.RemoveVolume(buildVolume); err != nil {
+			if returnedError != nil {
+				returnedError = fmt.Errorf("%w, also %v", returnedError, err)
+			} else {
+				returnedError = err
+			}
+		}
+	}()
+
+	terraformContainer, err := terraform.NewContainer(
+		ctx,
+		state.DockerClient,
+		terraformImage,
+		state.CodeDir,
+		buildVolume,
+		args.TerraformLogLevel,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := terraformContainer.Done(); err != nil {
+			if returnedError != nil {
+				returnedError = fmt.Errorf("%w, also %v", returnedError, err)
+			} else {
+				returnedError = err
+			}
+		}
+	}()
+
+	if err := terraformContainer.CopyTerraformLockIfExists(state.ErrorStream, state.ErrorStream); err != nil {
+		return err
+	}
+
+	if err := terraformContainer.ConfigureBackend(state.ErrorStream, state.ErrorStream, prepareTerraformResponse, false); err != nil {
+		return err
+	}
+
+	if err := terraformContainer.SwitchWorkspace(args.EnvName, state.ErrorStream, state.ErrorStream); err != nil {
+		return err
+	}
+
+	planFilename := "/build/" + util.RandomName("plan")
+
+	planCommand := deploy.AppendConfigFiles([]string{"terraform", "plan", "-detailed-exitcode"}, state, args.EnvName)
+	planCommand = append(planCommand, "-out="+planFilename)
+
+	fmt.Fprintf(
+		state.ErrorStream,
+		"\n%s\n%s\n\n",
+		util.FormatInfo("checking for drift"),
+		util.FormatCommand(strings.Join(planCommand, " ")),
+	)
+
+	summary := Summary{ResourceChanges: []terraform.ResourceChange{}, OutputChanges: []string{}}
+
+	err = terraformContainer.RunCommand(planCommand, prepareTerraformResponse.Env, state.ErrorStream, state.ErrorStream)
+	var exitError *docker.ExitError
+	if errors.As(err, &exitError) && exitError.ExitCode == driftExitCode {
+		summary.Drift = true
+	} else if err != nil {
+		return err
+	}
+
+	if summary.Drift {
+		var planJSON bytes.Buffer
+		if err := terraformContainer.RunCommand(
+			[]string{"terraform", "show", "-json", planFilename}, prepareTerraformResponse.Env,
+			&planJSON, state.ErrorStream,
+		); err != nil {
+			return err
+		}
+		summary.ResourceChanges, summary.OutputChanges, err = terraform.GetPlanChanges(planJSON.Bytes())
+		if err != nil {
+			return fmt.Errorf("error reading plan: %w", err)
+		}
+	}
+
+	if err := WriteSummary(state.OutputStream, &summary); err != nil {
+		return err
+	}
+
+	if summary.Drift {
+		fmt.Fprintf(state.ErrorStream, "\n%s\n", util.FormatWarning(fmt.Sprintf("drift detected in %s", args.EnvName)))
+		return command.Failure(driftExitCode)
+	}
+	fmt.Fprintf(state.ErrorStream, "\n%s\n", util.FormatInfo(fmt.Sprintf("no drift in %s", args.EnvName)))
+	return nil
+}
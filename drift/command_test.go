@@ -0,0 +1,63 @@
+package drift_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/drift"
+	"github.com/mergermarket/cdflow2/terraform"
+)
+
+func TestParseArgs(t *testing.T) {
+	t.Run("env + version", func(t *testing.T) {
+		got, err := drift.ParseArgs([]string{"live", "1-abc", "-t", "DEBUG"})
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		want := drift.CommandArgs{EnvName: "live", Version: "1-abc", TerraformLogLevel: "DEBUG"}
+		if *got != want {
+			t.Errorf("got %+v want %+v", *got, want)
+		}
+	})
+
+	for name, args := range map[string][]string{
+		"no args":        {},
+		"no version":     {"live"},
+		"too many args":  {"live", "1", "2"},
+		"unknown option": {"--plan-only", "live", "1"},
+	} {
+		t.Run("sad path - "+name, func(t *testing.T) {
+			if _, err := drift.ParseArgs(args); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	var output bytes.Buffer
+	if err := drift.WriteSummary(&output, &drift.Summary{
+		Drift:           true,
+		ResourceChanges: []terraform.ResourceChange{{Address: "aws_s3_bucket.logs", Actions: []string{"update"}}},
+		OutputChanges:   []string{},
+	}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	want := `{
+  "drift": true,
+  "resource_changes": [
+    {
+      "address": "aws_s3_bucket.logs",
+      "actions": [
+        "update"
+      ]
+    }
+  ],
+  "output_changes": []
+}
+`
+	if output.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", output.String(), want)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
-	"strings"
 
 	"github.com/mergermarket/cdflow2/command"
 )
@@ -32,25 +31,33 @@ func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]st
 	return initFromBasicTemplate(state, args)
 }
 
+// NewArgParser returns the parser for the init options and arguments, which sets result.
+func NewArgParser(result *CommandArgs) *command.ArgParser {
+	return &command.ArgParser{
+		Name: "init",
+		Options: []command.Option{
+			command.CommandLineOnly(command.StringValue("name", "n", &result.Name)),
+			command.StringValue("boilerplate", "b", &result.Boilerplate),
+		},
+		// any other options are variables for the boilerplate templates
+		HandleUnknownOption: func(name string, take func() (string, error)) error {
+			value, err := take()
+			if err != nil {
+				return err
+			}
+			result.Variables[name] = value
+			return nil
+		},
+	}
+}
+
 // ParseArgs parse command line arguments for init command.
 func ParseArgs(args []string) (*CommandArgs, error) {
 	result := CommandArgs{Variables: map[string]string{}}
-	i := 0
 
-	take := func() (string, error) {
-		i++
-		if i >= len(args) {
-			return "", errors.New("missing value")
-		}
-
-		return args[i], nil
-	}
-
-	for ; i < len(args); i++ {
-		_, err := handleArgs(args[i], &result, take)
-		if err != nil {
-			return nil, err
-		}
+	parser := NewArgParser(&result)
+	if _, err := parser.Parse(args); err != nil {
+		return nil, err
 	}
 
 	if result.Name == "" {
@@ -124,45 +131,3 @@ func checkFolder(state *command.GlobalState, folder string) (bool, error) {
 
 	return false, nil
 }
-
-func handleArgs(arg string, commandArgs *CommandArgs, take func() (string, error)) (bool, error) {
-	if strings.HasPrefix(arg, "-") {
-		return handleFlag(arg, commandArgs, take)
-	} else {
-		return false, errors.New("unknown init argument: " + arg)
-	}
-}
-
-func handleFlag(arg string, commandArgs *CommandArgs, take func() (string, error)) (bool, error) {
-	if arg == "-n" || arg == "--name" {
-		value, err := take()
-		if err != nil {
-			return false, err
-		}
-		commandArgs.Name = value
-	} else if arg == "-b" || arg == "--boilerplate" {
-		value, err := take()
-		if err != nil {
-			return false, err
-		}
-		commandArgs.Boilerplate = value
-	} else {
-		if !strings.HasPrefix(arg, "--") {
-			return false, fmt.Errorf("option name must start with '--': %s", arg)
-		}
-
-		name := strings.TrimPrefix(arg, "--")
-
-		if name == "" {
-			return false, fmt.Errorf("missing option key")
-		}
-
-		value, err := take()
-		if err != nil {
-			return false, err
-		}
-
-		commandArgs.Variables[name] = value
-	}
-	return false, nil
-}
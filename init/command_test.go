@@ -49,6 +49,14 @@ func TestParseArgsInvalid(t *testing.T) {
 			t.Fatal("error expected from parseArgs")
 		}
 	})
+
+	t.Run("name isn't defaulted from the environment", func(t *testing.T) {
+		t.Setenv("CDFLOW2_NAME", "test-name")
+		_, err := ParseArgs([]string{})
+		if err == nil {
+			t.Fatal("error expected from parseArgs")
+		}
+	})
 }
 
 func TestBasicTemplate(t *testing.T) {
@@ -0,0 +1,188 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+
+	"github.com/mergermarket/cdflow2/command"
+	"github.com/mergermarket/cdflow2/config"
+	"github.com/mergermarket/cdflow2/util"
+)
+
+// CommandArgs contains specific arguments to the lock and unlock commands.
+type CommandArgs struct {
+	EnvName string
+	Reason  string
+}
+
+// ParseArgs parses command line arguments to the lock subcommand.
+func ParseArgs(args []string) (*CommandArgs, error) {
+	var result CommandArgs
+	if _, err := parseArgs(NewArgParser(&result), &result, args); err != nil {
+		return nil, err
+	}
+
+	if result.Reason == "" {
+		return nil, errors.New("--reason is required")
+	}
+
+	return &result, nil
+}
+
+// ParseUnlockArgs parses command line arguments to the unlock subcommand.
+func ParseUnlockArgs(args []string) (*CommandArgs, error) {
+	var result CommandArgs
+	return parseArgs(NewUnlockArgParser(&result), &result, args)
+}
+
+// NewArgParser returns the parser for the lock options and arguments, which sets result.
+func NewArgParser(result *CommandArgs) *command.ArgParser {
+	parser := newArgParser("lock", result)
+	parser.Options = []command.Option{command.CommandLineOnly(command.StringValue("reason", "r", &result.Reason))}
+	return parser
+}
+
+// NewUnlockArgParser returns the parser for the unlock arguments, which sets result.
+func NewUnlockArgParser(result *CommandArgs) *command.ArgParser {
+	return newArgParser("unlock", result)
+}
+
+func newArgParser(name string, result *CommandArgs) *command.ArgParser {
+	return &command.ArgParser{
+		Name: name,
+		HandleArg: func(arg string) (bool, error) {
+			if result.EnvName == "" {
+				result.EnvName = arg
+			} else {
+				return false, errors.New("unknown " + name + " argument: " + arg)
+			}
+			return false, nil
+		},
+	}
+}
+
+func parseArgs(parser *command.ArgParser, result *CommandArgs, args []string) (*CommandArgs, error) {
+	if _, err := parser.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if result.EnvName == "" {
+		return nil, errors.New("env argument is missing")
+	}
+
+	return result, nil
+}
+
+// lockedBy identifies who is locking an environment.
+func lockedBy() string {
+	username := "unknown"
+	if current, err := user.Current(); err == nil {
+		username = current.Username
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		return username + "@" + hostname
+	}
+	return username
+}
+
+// Describe returns a description of the lock on an environment for showing to the user.
+func Describe(envName string, lock *config.Lock) string {
+	result := fmt.Sprintf("environment %s is locked by %s", envName, lock.LockedBy)
+	if lock.Time != "" {
+		result += " at " + lock.Time
+	}
+	return result + ": " + lock.Reason
+}
+
+// Check returns an error if an environment is locked, unless force is set.
+func Check(ctx context.Context, state *command.GlobalState, envName string, force bool, env map[string]string) error {
+	lock, err := config.GetEnvironmentLock(ctx, state, envName, env)
+	return CheckResult(state.ErrorStream, envName, force, lock, err)
+}
+
+// CheckResult returns an error if the lock on an environment (or the error getting it) means the command shouldn't
+// continue, unless force is set. Config containers that don't support locks can't have locked the environment, but
+// any other failure to get the lock is treated like a lock, so that a broken config container can't let a deploy
+// through during a freeze.
+func CheckResult(errorStream io.Writer, envName string, force bool, lock *config.Lock, err error) error {
+	var unsupportedActionError *config.UnsupportedActionError
+	if errors.As(err, &unsupportedActionError) {
+		return nil
+	} else if err != nil {
+		if force {
+			fmt.Fprintf(errorStream, "\n%s\n", util.FormatWarning(fmt.Sprintf("unable to check environment lock: %v - continuing because of --force", err)))
+			return nil
+		}
+		return fmt.Errorf("unable to check environment lock: %w (use --force to override)", err)
+	}
+	if lock == nil {
+		return nil
+	}
+	if force {
+		fmt.Fprintf(errorStream, "\n%s\n", util.FormatWarning(Describe(envName, lock)+" - continuing because of --force"))
+		return nil
+	}
+	return errors.New(Describe(envName, lock) + " (use --force to override)")
+}
+
+// RunCommand runs the lock command.
+func RunCommand(ctx context.Context, state *command.GlobalState, args *CommandArgs, env map[string]string) (returnedError error) {
+	if err := config.Pull(state); err != nil {
+		return err
+	}
+
+	configContainer, err := config.NewContainer(ctx, state, state.Manifest.Config.Image, "")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := configContainer.Done(); err != nil {
+			if returnedError != nil {
+				returnedError = fmt.Errorf("%w, also %v", returnedError, err)
+			} else {
+				returnedError = err
+			}
+			return
+		}
+	}()
+
+	if _, err := configContainer.LockEnvironment(state.Component, args.EnvName, lockedBy(), args.Reason, state.Manifest.Config.Params, env); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(state.ErrorStream, "\n%s\n", util.FormatInfo(fmt.Sprintf("locked %s: %s", args.EnvName, args.Reason)))
+	return nil
+}
+
+// RunUnlockCommand runs the unlock command.
+func RunUnlockCommand(ctx context.Context, state *command.GlobalState, args *CommandArgs, env map[string]string) (returnedError error) {
+	if err := config.Pull(state); err != nil {
+		return err
+	}
+
+	configContainer, err := config.NewContainer(ctx, state, state.Manifest.Config.Image, "")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := configContainer.Done(); err != nil {
+			if returnedError != nil {
+				returnedError = fmt.Errorf("%w, also %v", returnedError, err)
+			} else {
+				returnedError = err
+			}
+			return
+		}
+	}()
+
+	if _, err := configContainer.UnlockEnvironment(state.Component, args.EnvName, state.Manifest.Config.Params, env); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(state.ErrorStream, "\n%s\n", util.FormatInfo("unlocked "+args.EnvName))
+	return nil
+}
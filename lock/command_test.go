@@ -0,0 +1,107 @@
+package lock_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/config"
+	"github.com/mergermarket/cdflow2/lock"
+)
+
+func TestParseArgs(t *testing.T) {
+	t.Run("env + reason", func(t *testing.T) {
+		args, err := lock.ParseArgs([]string{"live", "--reason", "manual fix for incident"})
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if args.EnvName != "live" || args.Reason != "manual fix for incident" {
+			t.Errorf("unexpected args: %+v", args)
+		}
+	})
+
+	for name, args := range map[string][]string{
+		"no env":        {"--reason", "x"},
+		"no reason":     {"live"},
+		"missing value": {"live", "-r"},
+		"too many args": {"live", "aslive", "-r", "x"},
+	} {
+		t.Run("sad path - "+name, func(t *testing.T) {
+			if _, err := lock.ParseArgs(args); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+
+	t.Run("reason isn't defaulted from the environment", func(t *testing.T) {
+		t.Setenv("CDFLOW2_REASON", "freeze")
+		if _, err := lock.ParseArgs([]string{"live"}); err == nil {
+			t.Error("expected error for missing reason")
+		}
+	})
+}
+
+func TestParseUnlockArgs(t *testing.T) {
+	args, err := lock.ParseUnlockArgs([]string{"live"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if args.EnvName != "live" {
+		t.Errorf("EnvName: got %q want live", args.EnvName)
+	}
+
+	if _, err := lock.ParseUnlockArgs([]string{"live", "--reason", "x"}); err == nil {
+		t.Error("expected error for --reason")
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	got := lock.Describe("live", &config.Lock{LockedBy: "alice@laptop", Reason: "incident", Time: "2024-01-02T03:04:05Z"})
+	want := "environment live is locked by alice@laptop at 2024-01-02T03:04:05Z: incident"
+	if got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	got = lock.Describe("live", &config.Lock{LockedBy: "bob", Reason: "freeze"})
+	want = "environment live is locked by bob: freeze"
+	if got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestCheckResult(t *testing.T) {
+	locked := &config.Lock{LockedBy: "bob", Reason: "freeze"}
+	failed := errors.New("config container exited")
+	unsupported := &config.UnsupportedActionError{Action: "get_environment_lock"}
+
+	for _, tc := range []struct {
+		name    string
+		lock    *config.Lock
+		err     error
+		force   bool
+		wantErr bool
+		warns   bool
+	}{
+		{"not locked", nil, nil, false, false, false},
+		{"locked", locked, nil, false, true, false},
+		{"locked with force", locked, nil, true, false, true},
+		{"failed", nil, failed, false, true, false},
+		{"failed with force", nil, failed, true, false, true},
+		{"unsupported", nil, unsupported, false, false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var errorBuffer bytes.Buffer
+			err := lock.CheckResult(&errorBuffer, "live", tc.force, tc.lock, tc.err)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, wanted error: %v", err, tc.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "--force") {
+				t.Fatalf("expected error to mention --force, got %q", err)
+			}
+			if (errorBuffer.Len() > 0) != tc.warns {
+				t.Fatalf("unexpected output %q", errorBuffer.String())
+			}
+		})
+	}
+}
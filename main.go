@@ -1,17 +1,32 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/mergermarket/cdflow2/clean"
 	"github.com/mergermarket/cdflow2/command"
+	"github.com/mergermarket/cdflow2/completion"
 	"github.com/mergermarket/cdflow2/deploy"
 	"github.com/mergermarket/cdflow2/destroy"
+	"github.com/mergermarket/cdflow2/diff"
+	"github.com/mergermarket/cdflow2/doctor"
+	"github.com/mergermarket/cdflow2/drift"
 	cinit "github.com/mergermarket/cdflow2/init"
+	"github.com/mergermarket/cdflow2/lock"
+	"github.com/mergermarket/cdflow2/output"
 	release "github.com/mergermarket/cdflow2/release/command"
+	"github.com/mergermarket/cdflow2/releases"
+	"github.com/mergermarket/cdflow2/rollback"
 	"github.com/mergermarket/cdflow2/setup"
 	"github.com/mergermarket/cdflow2/shell"
+	"github.com/mergermarket/cdflow2/userconfig"
 	"github.com/mergermarket/cdflow2/util"
+	"github.com/mergermarket/cdflow2/validate"
 )
 
 var version = "undefined"
@@ -24,8 +39,15 @@ const globalOptions = `Global options:
   --no-pull-config             - don't pull the config container (must exist).
   --no-pull-release            - don't pull the release container (must exist).
   --no-pull-terraform          - don't pull the terraform container (must exist).
+  --output text | json         - with json, write a summary of release, deploy, destroy or setup
+                                 to stdout as JSON (all other output goes to stderr).
+  --result-file FILE           - write the JSON summary to FILE instead of stdout.
   --version                    - print the version number and exit. 
-  --help                       - print the help message and exit.`
+  --help                       - print the help message and exit.
+
+Options can also be given as --name=value, short options combined (e.g. -pf) and every option
+defaults to a CDFLOW2_ environment variable named after it (e.g. CDFLOW2_TERRAFORM_LOG_LEVEL),
+or failing that the user defaults file (see "cdflow2 help config").`
 
 const help = `
 Usage:
@@ -37,9 +59,21 @@ Commands:
   setup                                   - configure your pipeline
   init    [ OPTS ]                        - initialize a new project
   release [ OPTS ] VERSION                - build and publish a new software artifact
+  releases list | show VERSION            - list stored releases or show the details of one
+  diff    ENV VERSION_A VERSION_B         - compare two releases
   deploy  [ OPTS ] ENV VERSION            - create & update infrastructure using software artifact
+  rollback [ OPTS ] ENV                   - redeploy the previously deployed version to ENV
+  drift   [ OPTS ] ENV VERSION            - check whether ENV has drifted from VERSION, without applying anything
   destroy [ OPTS ] ENV VERSION            - destroy all Terraform managed infrastructure in ENV
+  lock    ENV --reason REASON             - stop deploys to and destroys of ENV until it is unlocked
+  unlock  ENV                             - remove the lock on ENV
   shell   ENV [ OPTS ] [ SHELLARGS ]      - access terraform for debugging and tf state manipulation
+  output  [ OPTS ] ENV [ NAME ]           - print the terraform outputs for ENV as JSON
+  validate                                - check cdflow.yaml, config files and infra without running anything
+  clean   [ OPTS ]                        - remove containers and volumes left behind by cdflow2 runs that didn't finish
+  doctor                                  - check your environment is set up to run cdflow2
+  config  show                            - show the options set by the user defaults file or environment
+  completion bash | zsh | fish            - print a shell completion script
   help    [ COMMAND ]                     - display detailed help and usage information for a command
 
 ` + globalOptions
@@ -58,6 +92,38 @@ Options:
 
   --release-data | -r            - add key/value to release metadata (i.e. --release-data foo=bar).
   --terraform-log-level | -t     - set Terraform log level (TF_LOG), useful for debugging.
+  --dry-run | -n                 - run the builds and terraform init, but don't upload the release.
+  --export-dir | -e DIR          - copy the contents of the release to DIR before it would be uploaded.
+  --only BUILD_ID                - only run this build (can be repeated), marking the release as partial.
+  --skip BUILD_ID                - don't run this build (can be repeated), marking the release as partial.
+  --no-partial-upload            - fail rather than upload a partial release (e.g. CDFLOW2_NO_PARTIAL_UPLOAD=true in CI).
+  --parallelism | -p N           - run up to N builds at once (default 1), prefixing their output with the build id.
+
+` + globalOptions
+
+const releasesHelp = `
+Usage:
+
+  cdflow2 [ GLOBALOPTS ] releases list
+  cdflow2 [ GLOBALOPTS ] releases show VERSION
+
+Args:
+
+  VERSION                        - the version of the release to show.
+
+With the --output json global option the releases are written to stdout as JSON.
+
+` + globalOptions
+
+const diffHelp = `
+Usage:
+
+  cdflow2 [ GLOBALOPTS ] diff VERSION_A VERSION_B
+
+Args:
+
+  VERSION_A                      - the version to compare from.
+  VERSION_B                      - the version to compare to.
 
 ` + globalOptions
 
@@ -77,10 +143,50 @@ Options:
   --refresh-only | -r            - refresh the state only, don't apply.
   --new-state | -n               - allow run without a pre-existing tfstate file.
   --error-on-destroy | -e        - fail if a plan return any resources to destroy.
+  --force | -f                   - deploy even if the environment is locked (see cdflow2 lock).
+  --accept-findings              - deploy to a protected environment even if the release has security findings.
   --terraform-log-level | -t     - set Terraform log level (TF_LOG), useful for debugging.
 
 ` + globalOptions
 
+const rollbackHelp = `
+Usage:
+
+  cdflow2 [ GLOBALOPTS ] rollback [ OPTS ] ENV
+
+Args:
+
+  ENV                            - the environment being rolled back.
+
+Options:
+
+  --steps | -s                   - how many previously deployed versions to go back (default 1).
+  --plan-only | -p               - create the terraform plan only, don't apply.
+  --force | -f                   - deploy even if the environment is locked (see cdflow2 lock).
+  --accept-findings              - deploy to a protected environment even if the release has security findings.
+  --terraform-log-level | -t     - set Terraform log level (TF_LOG), useful for debugging.
+
+` + globalOptions
+
+const driftHelp = `
+Usage:
+
+  cdflow2 [ GLOBALOPTS ] drift [ OPTS ] ENV VERSION
+
+Args:
+
+  ENV                            - the environment to check.
+  VERSION                        - the version expected to be deployed (must match what was released).
+
+Options:
+
+  --terraform-log-level | -t     - set Terraform log level (TF_LOG), useful for debugging.
+
+Runs terraform plan -detailed-exitcode and writes a JSON summary of the changed resources to stdout.
+Exits with 0 when there is no drift, 2 when there is drift and 1 on error.
+
+` + globalOptions
+
 const setupHelp = `
 Usage:
 
@@ -109,6 +215,26 @@ Shell Arguments:
   	   (cdflow2 shell demo -v v1.0 -- echo test)
 ` + globalOptions
 
+const outputHelp = `
+Usage:
+
+  cdflow2 [ GLOBALOPTS ] output [ OPTS ] ENV [ NAME ]
+
+Args:
+
+  ENV                            - the environment containing the deployment.
+  NAME                           - the name of a single output to print (all outputs are printed by default).
+
+Options:
+
+  --raw | -r                     - print the value of the NAME output as a raw string rather than JSON.
+  --version | -v                 - the released version to setup terraform with.
+  --terraform-log-level | -t     - set Terraform log level (TF_LOG), useful for debugging.
+
+Only the output of terraform output is written to stdout, so it can be parsed.
+
+` + globalOptions
+
 const destroyHelp = `
 Usage:
 
@@ -122,10 +248,112 @@ Args:
 Options:
 
   --plan-only | -p               - generate an execution plan only, don't destroy.
+  --force | -f                   - destroy even if the environment is locked (see cdflow2 lock).
   --terraform-log-level | -t     - set Terraform log level (TF_LOG), useful for debugging.
 
 ` + globalOptions
 
+const lockHelp = `
+Usage:
+
+  cdflow2 [ GLOBALOPTS ] lock ENV --reason REASON
+
+Args:
+
+  ENV                            - the environment to lock.
+
+Options:
+
+  --reason | -r                  - why the environment is being locked (required), shown when a deploy is refused.
+
+While an environment is locked deploy, rollback and destroy refuse to run against it unless --force is passed.
+
+` + globalOptions
+
+const unlockHelp = `
+Usage:
+
+  cdflow2 [ GLOBALOPTS ] unlock ENV
+
+Args:
+
+  ENV                            - the environment to unlock.
+
+` + globalOptions
+
+const validateHelp = `
+Usage:
+
+  cdflow2 [ GLOBALOPTS ] validate
+
+Checks cdflow.yaml, the config files and the infra directory, reporting all problems found
+and exiting with a non-zero status if there are any.
+
+` + globalOptions
+
+const doctorHelp = `
+Usage:
+
+  cdflow2 [ GLOBALOPTS ] doctor
+
+Checks docker, git, registry credentials for the images in cdflow.yaml and the cache volume,
+printing a checklist with hints for anything that needs fixing.
+
+` + globalOptions
+
+const cleanHelp = `
+Usage:
+
+  cdflow2 [ GLOBALOPTS ] clean [ OPTS ]
+
+Removes containers and volumes left behind by cdflow2 runs that didn't finish (e.g. because
+cdflow2 crashed or was killed). Those created by a cdflow2 process that is still running on
+this machine are left alone, as are those created on other machines unless --all-hosts is given.
+
+Options:
+
+  --older-than | -o              - only remove containers and volumes older than this duration (default 1h).
+  --dry-run | -n                 - list what would be removed without removing anything.
+  --all-hosts | -a               - also remove those created on other machines sharing the docker daemon.
+
+` + globalOptions
+
+const configHelp = `
+Usage:
+
+  cdflow2 [ GLOBALOPTS ] config show
+
+Shows the options that are set and where each value came from. Options default to the value
+of a CDFLOW2_ environment variable named after them (e.g. CDFLOW2_TERRAFORM_LOG_LEVEL), or
+failing that the user defaults file, ~/.config/cdflow2/config.yaml (or $XDG_CONFIG_HOME/cdflow2/config.yaml,
+or the file named by CDFLOW2_USER_CONFIG). Options given on the command line take precedence
+over both. For example:
+
+  global:
+    no-pull-release: true
+    config-param:
+      - team=platform
+  commands:
+    deploy:
+      terraform-log-level: INFO
+
+` + globalOptions
+
+const completionHelp = `
+Usage:
+
+  cdflow2 [ GLOBALOPTS ] completion bash | zsh | fish
+
+Prints a script that completes commands, options and environment names (from the config files
+in config_files_folder) for the given shell. To enable it add one of the following to your
+shell's startup file:
+
+  bash: source <(cdflow2 completion bash)
+  zsh:  source <(cdflow2 completion zsh)
+  fish: cdflow2 completion fish | source
+
+` + globalOptions
+
 const initHelp = `
 Usage:
 
@@ -150,22 +378,84 @@ Boilerplate Templates:
 
 ` + globalOptions
 
-func usage(subcommand string) {
+// usage writes the help for a command (or the general help if subcommand is empty) to outputStream.
+func usage(outputStream io.Writer, subcommand string) {
 	if subcommand == "release" {
-		fmt.Println(releaseHelp)
+		fmt.Fprintln(outputStream, releaseHelp)
+	} else if subcommand == "releases" {
+		fmt.Fprintln(outputStream, releasesHelp)
+	} else if subcommand == "diff" {
+		fmt.Fprintln(outputStream, diffHelp)
 	} else if subcommand == "deploy" {
-		fmt.Println(deployHelp)
+		fmt.Fprintln(outputStream, deployHelp)
+	} else if subcommand == "rollback" {
+		fmt.Fprintln(outputStream, rollbackHelp)
+	} else if subcommand == "drift" {
+		fmt.Fprintln(outputStream, driftHelp)
 	} else if subcommand == "shell" {
-		fmt.Println(shellHelp)
+		fmt.Fprintln(outputStream, shellHelp)
+	} else if subcommand == "output" {
+		fmt.Fprintln(outputStream, outputHelp)
 	} else if subcommand == "setup" {
-		fmt.Println(setupHelp)
+		fmt.Fprintln(outputStream, setupHelp)
 	} else if subcommand == "destroy" {
-		fmt.Println(destroyHelp)
+		fmt.Fprintln(outputStream, destroyHelp)
 	} else if subcommand == "init" {
-		fmt.Println(initHelp)
+		fmt.Fprintln(outputStream, initHelp)
+	} else if subcommand == "lock" {
+		fmt.Fprintln(outputStream, lockHelp)
+	} else if subcommand == "unlock" {
+		fmt.Fprintln(outputStream, unlockHelp)
+	} else if subcommand == "validate" {
+		fmt.Fprintln(outputStream, validateHelp)
+	} else if subcommand == "doctor" {
+		fmt.Fprintln(outputStream, doctorHelp)
+	} else if subcommand == "clean" {
+		fmt.Fprintln(outputStream, cleanHelp)
+	} else if subcommand == "config" {
+		fmt.Fprintln(outputStream, configHelp)
+	} else if subcommand == "completion" {
+		fmt.Fprintln(outputStream, completionHelp)
 	} else {
-		fmt.Println(help)
+		fmt.Fprintln(outputStream, help)
+	}
+}
+
+// commandsWithoutRepo don't need to be run in a project, or load cdflow.yaml themselves in order to report all
+// problems rather than the first.
+var commandsWithoutRepo = map[string]bool{
+	"init":     true,
+	"validate": true,
+	"doctor":   true,
+	"clean":    true,
+}
+
+// resultCommands support the --output json and --result-file global options.
+var resultCommands = map[string]bool{
+	"release": true,
+	"deploy":  true,
+	"destroy": true,
+	"setup":   true,
+}
+
+// writeResult writes the JSON summary of a command to stdout, or resultFile if set.
+func writeResult(result *command.Result, status int, resultFile string) error {
+	if result.Status == "" {
+		var err error
+		if status != 0 {
+			err = fmt.Errorf("exited with status %d", status)
+		}
+		result.Finish(err)
 	}
+	if resultFile == "" {
+		return result.Write(os.Stdout)
+	}
+	file, err := os.Create(resultFile)
+	if err != nil {
+		return fmt.Errorf("error writing result file: %w", err)
+	}
+	defer file.Close()
+	return result.Write(file)
 }
 
 var globalOptionErrorFormat = `
@@ -183,36 +473,104 @@ func main() {
 	os.Exit(runCommand())
 }
 
+// interruptContext returns a context that is cancelled by the first Ctrl-C or SIGTERM, so that the running command
+// can interrupt terraform and clean up its containers and volumes. A second signal exits immediately as normal.
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		if _, ok := <-signals; !ok {
+			return
+		}
+		signal.Stop(signals)
+		fmt.Fprintf(os.Stderr, "\n%s\n", util.FormatWarning("interrupted, cleaning up (interrupt again to exit immediately)"))
+		cancel()
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(signals)
+		cancel()
+	}
+}
+
+// invalidArgsStatus returns the exit status for invalid arguments to a command, which is 2 except for drift, where 2
+// means drift was found.
+func invalidArgsStatus(commandName string) int {
+	if commandName == "drift" {
+		return 1
+	}
+	return 2
+}
+
 func runCommand() (status int) {
 	globalArgs, remainingArgs, err := command.ParseArgs(os.Args[1:])
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, globalOptionErrorFormat, err)
-		return 2
+		return invalidArgsStatus(command.FindCommand(os.Args[1:]))
+	}
+	// with --output json stdout is only for JSON
+	usageStream := io.Writer(os.Stdout)
+	if globalArgs.Output == command.OutputJSON {
+		usageStream = os.Stderr
 	}
+
 	if globalArgs.Command == "" {
-		usage("")
+		usage(usageStream, "")
 		return 2
 	} else if globalArgs.Command == "help" {
 		subcommand := ""
 		if len(remainingArgs) > 0 {
 			subcommand = remainingArgs[0]
 		}
-		usage(subcommand)
+		usage(usageStream, subcommand)
 		return 0
 	} else if globalArgs.Command == "version" {
 		fmt.Println(version)
 		return 0
+	} else if globalArgs.Command == "config" {
+		if _, err := userconfig.ParseArgs(remainingArgs); err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
+			usage(usageStream, "config")
+			return 2
+		}
+		if err := userconfig.RunCommand(os.Stdout, os.Args[1:], os.LookupEnv); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	} else if globalArgs.Command == "completion" {
+		completionArgs, err := completion.ParseArgs(remainingArgs)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
+			usage(usageStream, "completion")
+			return 2
+		}
+		codeDir, err := os.Getwd()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := completion.RunCommand(os.Stdout, codeDir, completionArgs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
 	}
 
-	state, err := command.GetGlobalState(globalArgs, globalArgs.Command != "init")
+	repoShouldExist := !commandsWithoutRepo[globalArgs.Command]
+
+	state, err := command.GetGlobalState(globalArgs, repoShouldExist)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
 
+	// errors in the arguments to the command aren't reported to monitoring
+	invalidArgs := false
 	defer func() {
-		if globalArgs.Command == "init" || status == 2 {
+		if !repoShouldExist || invalidArgs {
 			return
 		}
 
@@ -224,35 +582,132 @@ func runCommand() (status int) {
 		state.MonitoringClient.SubmitEvent()
 	}()
 
+	if resultCommands[globalArgs.Command] && (globalArgs.Output == command.OutputJSON || globalArgs.ResultFile != "") {
+		state.Result = command.NewResult(globalArgs.Command, state.Component)
+		if globalArgs.ResultFile == "" {
+			// stdout is just for the result
+			state.OutputStream = state.ErrorStream
+		}
+		defer func() {
+			if err := writeResult(state.Result, status, globalArgs.ResultFile); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				if status == 0 {
+					status = 1
+				}
+			}
+		}()
+	}
+
 	env := util.GetEnv(os.Environ())
 
+	ctx, stop := interruptContext()
+	defer stop()
+
 	if globalArgs.Command == "release" {
 		releaseArgs, err := release.ParseArgs(remainingArgs)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
-			usage("release")
+			invalidArgs = true
+			usage(usageStream, "release")
 			return 2
 		}
 		state.MonitoringClient.ReleaseVersion = releaseArgs.Version
-		if err := release.RunCommand(state, *releaseArgs, env); err != nil {
+		state.Result.SetVersion(releaseArgs.Version)
+		if err := release.RunCommand(ctx, state, *releaseArgs, env); err != nil {
+			state.Result.Finish(err)
 			if status, ok := err.(command.Failure); ok {
 				return int(status)
 			}
 			fmt.Fprintln(os.Stderr, "\n"+err.Error())
 			return 1
 		}
+	} else if globalArgs.Command == "releases" {
+		releasesArgs, err := releases.ParseArgs(remainingArgs)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
+			invalidArgs = true
+			usage(usageStream, "releases")
+			return 2
+		}
+
+		state.MonitoringClient.ReleaseVersion = releasesArgs.Version
+
+		if err := releases.RunCommand(ctx, state, releasesArgs, env); err != nil {
+			if status, ok := err.(command.Failure); ok {
+				return int(status)
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else if globalArgs.Command == "diff" {
+		diffArgs, err := diff.ParseArgs(remainingArgs)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
+			invalidArgs = true
+			usage(usageStream, "diff")
+			return 2
+		}
+
+		if err := diff.RunCommand(ctx, state, diffArgs, env); err != nil {
+			if status, ok := err.(command.Failure); ok {
+				return int(status)
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
 	} else if globalArgs.Command == "deploy" {
 		deployArgs, err := deploy.ParseArgs(remainingArgs)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
-			usage("deploy")
+			invalidArgs = true
+			usage(usageStream, "deploy")
 			return 2
 		}
 
 		state.MonitoringClient.Environment = deployArgs.EnvName
 		state.MonitoringClient.ReleaseVersion = deployArgs.Version
+		state.Result.SetEnvironment(deployArgs.EnvName)
+		state.Result.SetVersion(deployArgs.Version)
+
+		if err := deploy.RunCommand(ctx, state, deployArgs, env); err != nil {
+			state.Result.Finish(err)
+			if status, ok := err.(command.Failure); ok {
+				return int(status)
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else if globalArgs.Command == "rollback" {
+		rollbackArgs, err := rollback.ParseArgs(remainingArgs)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
+			invalidArgs = true
+			usage(usageStream, "rollback")
+			return 2
+		}
+
+		state.MonitoringClient.Environment = rollbackArgs.EnvName
 
-		if err := deploy.RunCommand(state, deployArgs, env); err != nil {
+		if err := rollback.RunCommand(ctx, state, rollbackArgs, env); err != nil {
+			if status, ok := err.(command.Failure); ok {
+				return int(status)
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else if globalArgs.Command == "drift" {
+		driftArgs, err := drift.ParseArgs(remainingArgs)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
+			invalidArgs = true
+			usage(usageStream, "drift")
+			return invalidArgsStatus("drift")
+		}
+
+		state.MonitoringClient.Environment = driftArgs.EnvName
+		state.MonitoringClient.ReleaseVersion = driftArgs.Version
+
+		if err := drift.RunCommand(ctx, state, driftArgs, env); err != nil {
 			if status, ok := err.(command.Failure); ok {
 				return int(status)
 			}
@@ -263,14 +718,15 @@ func runCommand() (status int) {
 		shellArgs, err := shell.ParseArgs(remainingArgs)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
-			usage("shell")
+			invalidArgs = true
+			usage(usageStream, "shell")
 			return 2
 		}
 
 		state.MonitoringClient.Environment = shellArgs.EnvName
 		state.MonitoringClient.ReleaseVersion = shellArgs.Version
 
-		if err := shell.RunCommand(state, shellArgs, env); err != nil {
+		if err := shell.RunCommand(ctx, state, shellArgs, env); err != nil {
 			if status, ok := err.(command.Failure); ok {
 				return int(status)
 			}
@@ -278,14 +734,35 @@ func runCommand() (status int) {
 			return 1
 		}
 
+	} else if globalArgs.Command == "output" {
+		outputArgs, err := output.ParseArgs(remainingArgs)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
+			invalidArgs = true
+			usage(usageStream, "output")
+			return 2
+		}
+
+		state.MonitoringClient.Environment = outputArgs.EnvName
+		state.MonitoringClient.ReleaseVersion = outputArgs.Version
+
+		if err := output.RunCommand(ctx, state, outputArgs, env); err != nil {
+			if status, ok := err.(command.Failure); ok {
+				return int(status)
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
 	} else if globalArgs.Command == "setup" {
 		if len(remainingArgs) != 0 {
 			fmt.Fprintln(os.Stderr, "Error: setup has no arguments")
-			usage("setup")
+			invalidArgs = true
+			usage(usageStream, "setup")
 			return 2
 		}
 
-		if err := setup.RunCommand(state, env); err != nil {
+		if err := setup.RunCommand(ctx, state, env); err != nil {
+			state.Result.Finish(err)
 			if status, ok := err.(command.Failure); ok {
 				return int(status)
 			}
@@ -296,14 +773,100 @@ func runCommand() (status int) {
 		destroyArgs, err := destroy.ParseArgs(remainingArgs)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
-			usage("destroy")
+			invalidArgs = true
+			usage(usageStream, "destroy")
 			return 2
 		}
 
 		state.MonitoringClient.Environment = destroyArgs.EnvName
 		state.MonitoringClient.ReleaseVersion = destroyArgs.Version
+		state.Result.SetEnvironment(destroyArgs.EnvName)
+		state.Result.SetVersion(destroyArgs.Version)
+
+		if err := destroy.RunCommand(ctx, state, destroyArgs, env); err != nil {
+			state.Result.Finish(err)
+			if status, ok := err.(command.Failure); ok {
+				return int(status)
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else if globalArgs.Command == "lock" {
+		lockArgs, err := lock.ParseArgs(remainingArgs)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
+			invalidArgs = true
+			usage(usageStream, "lock")
+			return 2
+		}
+
+		state.MonitoringClient.Environment = lockArgs.EnvName
+
+		if err := lock.RunCommand(ctx, state, lockArgs, env); err != nil {
+			if status, ok := err.(command.Failure); ok {
+				return int(status)
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else if globalArgs.Command == "unlock" {
+		unlockArgs, err := lock.ParseUnlockArgs(remainingArgs)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
+			invalidArgs = true
+			usage(usageStream, "unlock")
+			return 2
+		}
+
+		state.MonitoringClient.Environment = unlockArgs.EnvName
+
+		if err := lock.RunUnlockCommand(ctx, state, unlockArgs, env); err != nil {
+			if status, ok := err.(command.Failure); ok {
+				return int(status)
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else if globalArgs.Command == "validate" {
+		if err := validate.ParseArgs(remainingArgs); err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
+			invalidArgs = true
+			usage(usageStream, "validate")
+			return 2
+		}
+
+		if err := validate.RunCommand(state); err != nil {
+			if status, ok := err.(command.Failure); ok {
+				return int(status)
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else if globalArgs.Command == "doctor" {
+		if err := doctor.ParseArgs(remainingArgs); err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
+			invalidArgs = true
+			usage(usageStream, "doctor")
+			return 2
+		}
+
+		if err := doctor.RunCommand(state); err != nil {
+			if status, ok := err.(command.Failure); ok {
+				return int(status)
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else if globalArgs.Command == "clean" {
+		cleanArgs, err := clean.ParseArgs(remainingArgs)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
+			invalidArgs = true
+			usage(usageStream, "clean")
+			return 2
+		}
 
-		if err := destroy.RunCommand(state, destroyArgs, env); err != nil {
+		if err := clean.RunCommand(ctx, state, cleanArgs); err != nil {
 			if status, ok := err.(command.Failure); ok {
 				return int(status)
 			}
@@ -314,7 +877,8 @@ func runCommand() (status int) {
 		initArgs, err := cinit.ParseArgs(remainingArgs)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error: %s", err))
-			usage("init")
+			invalidArgs = true
+			usage(usageStream, "init")
 			return 2
 		}
 
@@ -326,7 +890,8 @@ func runCommand() (status int) {
 			return 1
 		}
 	} else {
-		usage("")
+		invalidArgs = true
+		usage(usageStream, "")
 		return 2
 	}
 
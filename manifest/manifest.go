@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path"
+	"sort"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -16,6 +19,19 @@ type Manifest struct {
 	Builds            map[string]ImageWithParamsAndEnvVars `yaml:"builds"`
 	Terraform         Terraform                            `yaml:"terraform"`
 	Trivy             Trivy                                `yaml:"trivy"`
+	// ProtectedEnvironments are patterns (see path.Match) for environments that releases with security findings can't
+	// be deployed to without --accept-findings.
+	ProtectedEnvironments []string `yaml:"protected_environments"`
+}
+
+// IsProtectedEnvironment returns true if envName matches one of the protected_environments patterns.
+func (manifest *Manifest) IsProtectedEnvironment(envName string) bool {
+	for _, pattern := range manifest.ProtectedEnvironments {
+		if matched, err := path.Match(pattern, envName); err == nil && matched {
+			return true
+		}
+	}
+	return false
 }
 
 // ImageWithParams represents either the config or a build key in cdflow.yaml.
@@ -25,9 +41,27 @@ type ImageWithParams struct {
 }
 
 type ImageWithParamsAndEnvVars struct {
-	Image   string                 `yaml:"image"`
-	Params  map[string]interface{} `yaml:"params"`
-	EnvVars []string               `yaml:"env_vars"`
+	Image     string                 `yaml:"image"`
+	Params    map[string]interface{} `yaml:"params"`
+	EnvVars   []string               `yaml:"env_vars"`
+	DependsOn []string               `yaml:"depends_on"`
+	Timeout   string                 `yaml:"timeout"`
+	Retries   int                    `yaml:"retries"`
+}
+
+// TimeoutDuration returns the timeout for each attempt at the build (e.g. "30m"), or zero if there isn't one.
+func (build *ImageWithParamsAndEnvVars) TimeoutDuration() (time.Duration, error) {
+	if build.Timeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(build.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: %w", build.Timeout, err)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q: must be positive", build.Timeout)
+	}
+	return timeout, nil
 }
 
 // Terraform represents the data in the terraform key in cdflow.yaml.
@@ -52,3 +86,51 @@ func Load(dir string) (*Manifest, error) {
 	}
 	return &result, nil
 }
+
+// BuildOrder returns the ids of builds in an order where each comes after the builds it depends on, otherwise sorted by
+// id. It returns an error if a build depends on one that doesn't exist or if there is a cycle.
+func BuildOrder(builds map[string]ImageWithParamsAndEnvVars) ([]string, error) {
+	remaining := make(map[string]int) // number of dependencies each build is waiting for
+	dependents := make(map[string][]string)
+	for buildID, build := range builds {
+		for _, dependency := range build.DependsOn {
+			if _, ok := builds[dependency]; !ok {
+				return nil, fmt.Errorf("build %q depends on %q, which doesn't exist", buildID, dependency)
+			}
+			remaining[buildID]++
+			dependents[dependency] = append(dependents[dependency], buildID)
+		}
+	}
+
+	var ready []string
+	for buildID := range builds {
+		if remaining[buildID] == 0 {
+			ready = append(ready, buildID)
+		}
+	}
+	result := make([]string, 0, len(builds))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		buildID := ready[0]
+		ready = ready[1:]
+		result = append(result, buildID)
+		for _, dependent := range dependents[buildID] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(result) < len(builds) {
+		var cycle []string
+		for buildID := range builds {
+			if remaining[buildID] > 0 {
+				cycle = append(cycle, buildID)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("builds have circular dependencies: %s", strings.Join(cycle, ", "))
+	}
+	return result, nil
+}
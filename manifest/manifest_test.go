@@ -4,6 +4,7 @@ import (
 	"log"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/mergermarket/cdflow2/manifest"
 	"github.com/mergermarket/cdflow2/test"
@@ -35,3 +36,73 @@ func TestLoad(t *testing.T) {
 		log.Fatalln("unexpected config params from manifest:", loadedManifest.Config.Params)
 	}
 }
+
+func TestBuildOrder(t *testing.T) {
+	order, err := manifest.BuildOrder(map[string]manifest.ImageWithParamsAndEnvVars{
+		"lambda": {DependsOn: []string{"layer"}},
+		"layer":  {DependsOn: []string{"base"}},
+		"base":   {},
+		"docker": {},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"base", "docker", "layer", "lambda"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("got %v, want %v", order, want)
+	}
+
+	for name, builds := range map[string]map[string]manifest.ImageWithParamsAndEnvVars{
+		"unknown dependency": {"lambda": {DependsOn: []string{"layer"}}},
+		"self dependency":    {"lambda": {DependsOn: []string{"lambda"}}},
+		"cycle": {
+			"a": {DependsOn: []string{"b"}},
+			"b": {DependsOn: []string{"a"}},
+			"c": {},
+		},
+	} {
+		t.Run("sad path - "+name, func(t *testing.T) {
+			if _, err := manifest.BuildOrder(builds); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestTimeoutDuration(t *testing.T) {
+	for timeout, want := range map[string]time.Duration{
+		"":    0,
+		"90s": 90 * time.Second,
+		"1h":  time.Hour,
+	} {
+		build := manifest.ImageWithParamsAndEnvVars{Timeout: timeout}
+		got, err := build.TimeoutDuration()
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", timeout, err)
+		}
+		if got != want {
+			t.Errorf("got %v for %q, want %v", got, timeout, want)
+		}
+	}
+
+	for _, timeout := range []string{"30", "-1m", "0s"} {
+		build := manifest.ImageWithParamsAndEnvVars{Timeout: timeout}
+		if _, err := build.TimeoutDuration(); err == nil {
+			t.Errorf("expected error for %q", timeout)
+		}
+	}
+}
+
+func TestIsProtectedEnvironment(t *testing.T) {
+	loadedManifest := manifest.Manifest{ProtectedEnvironments: []string{"live", "prod-*"}}
+	for envName, want := range map[string]bool{
+		"live":      true,
+		"prod-eu":   true,
+		"aslive":    false,
+		"ci":        false,
+		"liveliest": false,
+	} {
+		if got := loadedManifest.IsProtectedEnvironment(envName); got != want {
+			t.Errorf("got %v for %q, want %v", got, envName, want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mergermarket/cdflow2/command"
+	"github.com/mergermarket/cdflow2/config"
+	"github.com/mergermarket/cdflow2/terraform"
+)
+
+// CommandArgs contains specific arguments to the output command.
+type CommandArgs struct {
+	EnvName           string
+	Name              string
+	Version           string
+	Raw               bool
+	TerraformLogLevel string
+}
+
+// NewArgParser returns the parser for the output options and arguments, which sets result.
+func NewArgParser(result *CommandArgs) *command.ArgParser {
+	return &command.ArgParser{
+		Name: "output",
+		Options: []command.Option{
+			command.CommandLineOnly(command.StringValue("version", "v", &result.Version)),
+			command.Flag("raw", "r", func() { result.Raw = true }),
+			command.StringValue("terraform-log-level", "t", &result.TerraformLogLevel),
+		},
+		HandleArg: func(arg string) (bool, error) {
+			if result.EnvName == "" {
+				result.EnvName = arg
+			} else if result.Name == "" {
+				result.Name = arg
+			} else {
+				return false, errors.New("unknown output argument: " + arg)
+			}
+			return false, nil
+		},
+	}
+}
+
+// ParseArgs parses command line arguments to the output subcommand.
+func ParseArgs(args []string) (*CommandArgs, error) {
+	var result CommandArgs
+
+	parser := NewArgParser(&result)
+	if _, err := parser.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if result.EnvName == "" {
+		return nil, errors.New("env argument is missing")
+	}
+
+	if result.Raw && result.Name == "" {
+		return nil, errors.New("--raw requires an output name")
+	}
+
+	return &result, nil
+}
+
+// OutputCommand returns the terraform command that prints the outputs.
+func OutputCommand(args *CommandArgs) []string {
+	result := []string{"terraform", "output"}
+	if args.Raw {
+		result = append(result, "-raw")
+	} else {
+		result = append(result, "-json")
+	}
+	if args.Name != "" {
+		result = append(result, args.Name)
+	}
+	return result
+}
+
+// RunCommand runs the output command.
+func RunCommand(ctx context.Context, state *command.GlobalState, args *CommandArgs, env map[string]string) (returnedError error) {
+	// everything apart from the outputs themselves goes to stderr so that stdout can be parsed
+	setupState := *state
+	setupState.OutputStream = state.ErrorStream
+
+	stateShouldExist := true
+	prepareTerraformResponse, buildVolume, terraformImage, err := config.SetupTerraform(ctx, &setupState, &stateShouldExist, args.EnvName, args.Version, env)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := state.DockerClient.RemoveVolume(buildVolume); err != nil {
+			if returnedError != nil {
+				returnedError = fmt.Errorf("%w, also %v", returnedError, err)
+			} else {
+				returnedError = err
+			}
+		}
+	}()
+
+	terraformContainer, err := terraform.NewContainer(
+		ctx,
+		state.DockerClient,
+		terraformImage,
+		state.CodeDir,
+		buildVolume,
+		args.TerraformLogLevel,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := terraformContainer.Done(); err != nil {
+			if returnedError != nil {
+				returnedError = fmt.Errorf("%w, also %v", returnedError, err)
+			} else {
+				returnedError = err
+			}
+		}
+	}()
+
+	if err := terraformContainer.ConfigureBackend(state.ErrorStream, state.ErrorStream, prepareTerraformResponse, true); err != nil {
+		return err
+	}
+
+	if err := terraformContainer.SwitchWorkspace(args.EnvName, state.ErrorStream, state.ErrorStream); err != nil {
+		return err
+	}
+
+	return terraformContainer.RunCommand(
+		OutputCommand(args), prepareTerraformResponse.Env,
+		state.OutputStream, state.ErrorStream,
+	)
+}
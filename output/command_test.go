@@ -0,0 +1,71 @@
+package output_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/output"
+)
+
+func TestParseArgs(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args []string
+		want output.CommandArgs
+	}{
+		"env only":          {[]string{"live"}, output.CommandArgs{EnvName: "live"}},
+		"env and name":      {[]string{"live", "service_url"}, output.CommandArgs{EnvName: "live", Name: "service_url"}},
+		"raw":               {[]string{"--raw", "live", "service_url"}, output.CommandArgs{EnvName: "live", Name: "service_url", Raw: true}},
+		"version":           {[]string{"--version", "1-abc", "live"}, output.CommandArgs{EnvName: "live", Version: "1-abc"}},
+		"terraform log lvl": {[]string{"live", "-t", "DEBUG"}, output.CommandArgs{EnvName: "live", TerraformLogLevel: "DEBUG"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := output.ParseArgs(tc.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(*got, tc.want) {
+				t.Errorf("got %+v, want %+v", *got, tc.want)
+			}
+		})
+	}
+
+	for name, args := range map[string][]string{
+		"no env":         {},
+		"raw no name":    {"--raw", "live"},
+		"too many args":  {"live", "a", "b"},
+		"unknown option": {"--foo", "live"},
+		"missing value":  {"live", "-v"},
+	} {
+		t.Run("sad path - "+name, func(t *testing.T) {
+			if _, err := output.ParseArgs(args); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+
+	t.Run("version isn't defaulted from the environment", func(t *testing.T) {
+		t.Setenv("CDFLOW2_VERSION", "1-abc")
+		got, err := output.ParseArgs([]string{"live"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.Version != "" {
+			t.Errorf("got version %q, want none", got.Version)
+		}
+	})
+}
+
+func TestOutputCommand(t *testing.T) {
+	for _, tc := range []struct {
+		args output.CommandArgs
+		want []string
+	}{
+		{output.CommandArgs{EnvName: "live"}, []string{"terraform", "output", "-json"}},
+		{output.CommandArgs{EnvName: "live", Name: "url"}, []string{"terraform", "output", "-json", "url"}},
+		{output.CommandArgs{EnvName: "live", Name: "url", Raw: true}, []string{"terraform", "output", "-raw", "url"}},
+	} {
+		if got := output.OutputCommand(&tc.args); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("got %v, want %v", got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mergermarket/cdflow2/command"
+	"github.com/mergermarket/cdflow2/manifest"
+	"github.com/mergermarket/cdflow2/release/container"
+	"github.com/mergermarket/cdflow2/trivy"
+	"github.com/mergermarket/cdflow2/util"
+)
+
+// buildRunner runs the builds of a release, up to parallelism at a time and each after the builds it depends on. When
+// builds run in parallel their output is prefixed with the build id, and the first build to fail cancels the others.
+type buildRunner struct {
+	state          *command.GlobalState
+	buildVolume    string
+	version        string
+	releaseEnv     map[string]map[string]string
+	trivyContainer *trivy.Container
+	parallelism    int
+
+	// guards the fields below, which are updated as builds finish
+	mutex           sync.Mutex
+	releaseMetadata map[string]map[string]string
+	findings        *trivy.ReleaseFindings
+	// software bills of materials to add to the release, keyed by filename
+	sboms map[string][]byte
+
+	// images are scanned one at a time, since they share the trivy container
+	scanMutex sync.Mutex
+}
+
+type buildFinished struct {
+	buildID string
+	err     error
+}
+
+// run runs builds, each after the builds it depends on, returning the error from the first to fail.
+func (runner *buildRunner) run(ctx context.Context, builds map[string]manifest.ImageWithParamsAndEnvVars) error {
+	pending, err := manifest.BuildOrder(builds)
+	if err != nil {
+		return err
+	}
+
+	parallelism := runner.parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	outputStream, errorStream := runner.state.OutputStream, runner.state.ErrorStream
+	prefixOutput := parallelism > 1 && len(pending) > 1
+	if prefixOutput {
+		outputStream, errorStream = util.NewSyncWriter(outputStream), util.NewSyncWriter(errorStream)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	finished := make(chan buildFinished)
+	completed := make(map[string]bool)
+	running := 0
+	var firstErr error
+	for {
+		// start the builds whose dependencies have completed, in order, unless a build has failed
+		var waiting []string
+		for _, buildID := range pending {
+			if firstErr != nil || ctx.Err() != nil || running == parallelism || !dependenciesCompleted(builds[buildID], completed) {
+				waiting = append(waiting, buildID)
+				continue
+			}
+			running++
+			go func(buildID string) {
+				if !prefixOutput {
+					finished <- buildFinished{buildID, runner.runBuild(ctx, buildID, builds[buildID], outputStream, errorStream)}
+					return
+				}
+				prefixedOutputStream := util.NewPrefixWriter(outputStream, "["+buildID+"] ")
+				prefixedErrorStream := util.NewPrefixWriter(errorStream, "["+buildID+"] ")
+				err := runner.runBuild(ctx, buildID, builds[buildID], prefixedOutputStream, prefixedErrorStream)
+				prefixedOutputStream.Flush()
+				prefixedErrorStream.Flush()
+				finished <- buildFinished{buildID, err}
+			}(buildID)
+		}
+		pending = waiting
+
+		if running == 0 {
+			break
+		}
+		result := <-finished
+		running--
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+				cancel()
+			}
+		} else {
+			completed[result.buildID] = true
+		}
+	}
+
+	if firstErr == nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+func dependenciesCompleted(build manifest.ImageWithParamsAndEnvVars, completed map[string]bool) bool {
+	for _, dependency := range build.DependsOn {
+		if !completed[dependency] {
+			return false
+		}
+	}
+	return true
+}
+
+// runContainer makes a single attempt at running a build, stopping and removing the container if it times out.
+func (runner *buildRunner) runContainer(
+	ctx context.Context,
+	buildID string,
+	build manifest.ImageWithParamsAndEnvVars,
+	timeout time.Duration,
+	env map[string]string,
+	outputStream, errorStream io.Writer,
+) (map[string]string, error) {
+	runCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	metadata, err := container.Run(
+		runCtx,
+		runner.state.DockerClient,
+		build.Image,
+		runner.state.CodeDir,
+		runner.buildVolume,
+		outputStream,
+		errorStream,
+		env,
+	)
+	if err != nil && ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("cdflow2: build '%v' timed out after %v", buildID, timeout)
+	} else if err != nil {
+		return nil, fmt.Errorf("cdflow2: error running build '%v' - %w", buildID, err)
+	}
+	return metadata, nil
+}
+
+// runBuild runs a single build and scans the image it produced (if any), generating an SBOM for it if configured.
+func (runner *buildRunner) runBuild(ctx context.Context, buildID string, build manifest.ImageWithParamsAndEnvVars, outputStream, errorStream io.Writer) error {
+	state := runner.state
+	env := make(map[string]string)
+	for k, v := range runner.releaseEnv[buildID] {
+		env[k] = v
+	}
+
+	// Inject build env bars into release container
+	PopulateEnvMap(build.EnvVars, env, errorStream)
+
+	// these are built in and cannot be overridden by the config container (since choosing the clashing name would likely be an accident)
+	env["VERSION"] = runner.version
+	env["COMPONENT"] = state.Component
+	env["COMMIT"] = state.Commit
+	env["BUILD_ID"] = buildID
+	manifestParams, err := json.Marshal(build.Params)
+	if err != nil {
+		return err
+	}
+	env["MANIFEST_PARAMS"] = string(manifestParams)
+	runner.mutex.Lock()
+	dependencyMetadata := make(map[string]map[string]string)
+	for _, dependency := range build.DependsOn {
+		dependencyMetadata[dependency] = runner.releaseMetadata[dependency]
+	}
+	runner.mutex.Unlock()
+	encodedDependencyMetadata, err := json.Marshal(dependencyMetadata)
+	if err != nil {
+		return err
+	}
+	env["DEPENDENCY_METADATA"] = string(encodedDependencyMetadata)
+	timeout, err := build.TimeoutDuration()
+	if err != nil {
+		return fmt.Errorf("cdflow2: build '%v' - %w", buildID, err)
+	}
+	endPhase := state.Result.StartPhase("build/" + buildID)
+	var metadata map[string]string
+	for attempt := 0; ; attempt++ {
+		metadata, err = runner.runContainer(ctx, buildID, build, timeout, env, outputStream, errorStream)
+		if err == nil {
+			break
+		}
+		if attempt >= build.Retries || ctx.Err() != nil {
+			return err
+		}
+		fmt.Fprintf(errorStream, "\n%s\n\n", util.FormatWarning(fmt.Sprintf(
+			"%v, retrying (attempt %d of %d)...", err, attempt+2, build.Retries+1,
+		)))
+	}
+	endPhase()
+	runner.mutex.Lock()
+	runner.releaseMetadata[buildID] = metadata
+	runner.mutex.Unlock()
+
+	if image, ok := metadata["image"]; ok && state.Manifest.Trivy.Image != "" {
+		runner.scanMutex.Lock()
+		defer runner.scanMutex.Unlock()
+		endPhase := state.Result.StartPhase("scan/" + buildID)
+		findings, err := runner.trivyContainer.ScanImage(image, errorStream)
+		if findings != nil {
+			runner.mutex.Lock()
+			runner.findings.Builds[buildID] = findings
+			runner.mutex.Unlock()
+		}
+		if err != nil {
+			return fmt.Errorf("cdflow2: error scanning image '%v' - %w", buildID, err)
+		}
+		endPhase()
+
+		if runner.trivyContainer.Config().SBOM() {
+			endPhase := state.Result.StartPhase("sbom/" + buildID)
+			sbom, err := runner.trivyContainer.ImageSBOM(image, errorStream)
+			if err != nil {
+				return fmt.Errorf("cdflow2: error generating SBOM for image '%v' - %w", buildID, err)
+			}
+			endPhase()
+			runner.mutex.Lock()
+			runner.sboms[runner.trivyContainer.SBOMFilename("sbom/builds/"+buildID)] = sbom
+			runner.mutex.Unlock()
+		}
+	}
+	return nil
+}
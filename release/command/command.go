@@ -1,6 +1,7 @@
 package command
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,14 +10,18 @@ import (
 	"log"
 	"net/url"
 	"os"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/mergermarket/cdflow2/command"
 	"github.com/mergermarket/cdflow2/config"
+	"github.com/mergermarket/cdflow2/manifest"
 	"github.com/mergermarket/cdflow2/release/container"
 	"github.com/mergermarket/cdflow2/terraform"
 	"github.com/mergermarket/cdflow2/trivy"
+	"github.com/mergermarket/cdflow2/util"
 )
 
 const MONITORING_SECURITY_FINDINGS = "release_critical_security_findings"
@@ -37,6 +42,12 @@ type CommandArgs struct {
 	ReleaseData       map[string]string
 	Version           string
 	TerraformLogLevel string
+	DryRun            bool
+	ExportDir         string
+	Only              []string
+	Skip              []string
+	NoPartialUpload   bool
+	Parallelism       int
 }
 
 func parseReleaseData(value string) (map[string]string, error) {
@@ -48,62 +59,62 @@ func parseReleaseData(value string) (map[string]string, error) {
 	}
 }
 
-func handleArgs(arg string, commandArgs *CommandArgs, take func() (string, error)) (bool, error) {
-	if strings.HasPrefix(arg, "-") {
-		return handleFlag(arg, commandArgs, take)
-	} else if commandArgs.Version == "" {
-		commandArgs.Version = arg
-	} else {
-		return false, errors.New("unknown release argument: " + arg)
-	}
-	return false, nil
-}
-
-func handleFlag(arg string, commandArgs *CommandArgs, take func() (string, error)) (bool, error) {
-	if arg == "-r" || arg == "--release-data" {
-		value, err := take()
-		if err != nil {
-			return false, err
-		}
-		releaseData, err := parseReleaseData(value)
-		if err != nil {
-			return false, err
-		}
-		for k, v := range releaseData {
-			commandArgs.ReleaseData[k] = v
-		}
-	} else if arg == "-t" || arg == "--terraform-log-level" {
-		value, err := take()
-		if err != nil {
-			return false, err
-		}
-
-		commandArgs.TerraformLogLevel = value
-	} else {
-		return false, errors.New("unknown release option: " + arg)
+// NewArgParser returns the parser for the release options and arguments, which sets result.
+func NewArgParser(result *CommandArgs) *command.ArgParser {
+	return &command.ArgParser{
+		Name: "release",
+		Options: []command.Option{
+			{Long: "release-data", Short: "r", TakesValue: true, Repeated: true, Handle: func(value string) error {
+				releaseData, err := parseReleaseData(value)
+				if err != nil {
+					return err
+				}
+				for k, v := range releaseData {
+					result.ReleaseData[k] = v
+				}
+				return nil
+			}},
+			command.StringValue("terraform-log-level", "t", &result.TerraformLogLevel),
+			command.Flag("dry-run", "n", func() { result.DryRun = true }),
+			command.StringValue("export-dir", "e", &result.ExportDir),
+			{Long: "only", TakesValue: true, Repeated: true, Handle: func(value string) error {
+				result.Only = append(result.Only, value)
+				return nil
+			}},
+			{Long: "skip", TakesValue: true, Repeated: true, Handle: func(value string) error {
+				result.Skip = append(result.Skip, value)
+				return nil
+			}},
+			command.Flag("no-partial-upload", "", func() { result.NoPartialUpload = true }),
+			command.Value("parallelism", "p", func(value string) error {
+				parallelism, err := strconv.Atoi(value)
+				if err != nil || parallelism < 1 {
+					return errors.New("parallelism must be a positive number: " + value)
+				}
+				result.Parallelism = parallelism
+				return nil
+			}),
+		},
+		HandleArg: func(arg string) (bool, error) {
+			if result.Version == "" {
+				result.Version = arg
+			} else {
+				return false, errors.New("unknown release argument: " + arg)
+			}
+			return false, nil
+		},
 	}
-	return false, nil
 }
 
 // ParseArgs parses command line arguments to the shell subcommand.
 func ParseArgs(args []string) (*CommandArgs, error) {
 	var result CommandArgs
 	result.ReleaseData = make(map[string]string)
+	result.Parallelism = 1
 
-	i := 0
-	take := func() (string, error) {
-		i++
-		if i >= len(args) {
-			return "", errors.New("missing value")
-		}
-
-		return args[i], nil
-	}
-	for ; i < len(args); i++ {
-		_, err := handleArgs(args[i], &result, take)
-		if err != nil {
-			return nil, err
-		}
+	parser := NewArgParser(&result)
+	if _, err := parser.Parse(args); err != nil {
+		return nil, err
 	}
 
 	if result.Version == "" {
@@ -155,7 +166,7 @@ func streamOutput(terraformOutputChan chan *output, outputStream, errorStream io
 	}
 }
 
-func terraformRelease(state *command.GlobalState, buildVolume string, outputStream, errorStream io.Writer, logLevel string) (image string, returnedError error) {
+func terraformRelease(ctx context.Context, state *command.GlobalState, buildVolume string, outputStream, errorStream io.Writer, logLevel string) (image string, returnedError error) {
 	dockerClient := state.DockerClient
 
 	if !state.GlobalArgs.NoPullTerraform {
@@ -181,6 +192,7 @@ func terraformRelease(state *command.GlobalState, buildVolume string, outputStre
 	}
 
 	terraformContainer, err := terraform.NewContainer(
+		ctx,
 		state.DockerClient,
 		savedTerraformImage,
 		state.CodeDir,
@@ -208,37 +220,85 @@ func terraformRelease(state *command.GlobalState, buildVolume string, outputStre
 // environment for each variable listed in envVars, which is sourced from
 // the 'env_vars' field in a YAML configuration file.
 //
-// For each variable, it logs whether the variable is set or missing,
+// For each variable, it writes whether the variable is set or missing to errorStream,
 // and inserts it into the env map with its value (or an empty string if unset).
 //
 // Note: Since maps are reference types in Go, modifications to the env map
 // inside this function will be reflected in the caller's scope.
-func PopulateEnvMap(envVars []string, env map[string]string) {
+func PopulateEnvMap(envVars []string, env map[string]string, errorStream io.Writer) {
 	for _, envVarName := range envVars {
 		envValue := os.Getenv(envVarName)
 
 		// *Important*: We don't print the value to avoid leaking secrets.
 		if envValue == "" {
-			fmt.Printf("\n- WARN: Environment variable '%s' is not set in host environment.", envVarName)
+			fmt.Fprintf(errorStream, "\n- WARN: Environment variable '%s' is not set in host environment.", envVarName)
 		} else {
-			fmt.Printf("\n- Adding Environment variable '%s' into cdflow release container.", envVarName)
+			fmt.Fprintf(errorStream, "\n- Adding Environment variable '%s' into cdflow release container.", envVarName)
 		}
 
 		env[envVarName] = envValue
 	}
 
 	// For output readability
-	fmt.Printf("\n\n")
+	fmt.Fprintf(errorStream, "\n\n")
+}
+
+// SelectBuilds returns the builds selected by the --only and --skip options (all of them if neither is given).
+func SelectBuilds(builds map[string]manifest.ImageWithParamsAndEnvVars, only, skip []string) (map[string]manifest.ImageWithParamsAndEnvVars, error) {
+	for _, buildID := range append(append([]string{}, only...), skip...) {
+		if _, ok := builds[buildID]; !ok {
+			return nil, fmt.Errorf("no build with id '%v' in cdflow.yaml", buildID)
+		}
+	}
+	result := make(map[string]manifest.ImageWithParamsAndEnvVars)
+	for buildID, build := range builds {
+		if len(only) > 0 && !slices.Contains(only, buildID) {
+			continue
+		}
+		if slices.Contains(skip, buildID) {
+			continue
+		}
+		result[buildID] = build
+	}
+	if len(result) == 0 {
+		return nil, errors.New("no builds selected")
+	}
+	if _, err := manifest.BuildOrder(builds); err != nil {
+		return nil, fmt.Errorf("cdflow.yaml: %w", err)
+	}
+	for buildID, build := range result {
+		for _, dependency := range build.DependsOn {
+			if _, ok := result[dependency]; !ok {
+				return nil, fmt.Errorf("build '%v' depends on '%v', which is not selected", buildID, dependency)
+			}
+		}
+	}
+	return result, nil
 }
 
 // RunCommand runs the release command.
-func RunCommand(state *command.GlobalState, releaseArgs CommandArgs, env map[string]string) (returnedError error) {
-	criticalSecurityFindings := false
+func RunCommand(ctx context.Context, state *command.GlobalState, releaseArgs CommandArgs, env map[string]string) (returnedError error) {
+	builds, err := SelectBuilds(state.Manifest.Builds, releaseArgs.Only, releaseArgs.Skip)
+	if err != nil {
+		return err
+	}
+	for buildID, build := range builds {
+		if _, err := build.TimeoutDuration(); err != nil {
+			return fmt.Errorf("cdflow.yaml: build '%v' - %w", buildID, err)
+		}
+	}
+	if len(builds) < len(state.Manifest.Builds) {
+		if releaseArgs.NoPartialUpload && !releaseArgs.DryRun {
+			return errors.New("not all builds are selected and uploading partial releases is forbidden (--no-partial-upload), use --dry-run")
+		}
+		fmt.Fprintln(state.ErrorStream, util.FormatWarning("not all builds are selected, the release will be marked as partial"))
+	}
+
+	findings := &trivy.ReleaseFindings{Builds: make(map[string]*trivy.Findings)}
 	trivyContainer := &trivy.Container{}
 
 	if state.Manifest.Trivy.Image != "" {
-		var err error
-		trivyContainer, err = GetScanContainer(state, releaseArgs)
+		trivyContainer, err = GetScanContainer(ctx, state, releaseArgs)
 		if err != nil {
 			return fmt.Errorf("cdflow2: error getting scan container: %w", err)
 		}
@@ -253,9 +313,21 @@ func RunCommand(state *command.GlobalState, releaseArgs CommandArgs, env map[str
 			}
 		}()
 
-		if criticalSecurityFindings, err = trivyContainer.ScanRepository(state.OutputStream, state.ErrorStream); err != nil {
+		endPhase := state.Result.StartPhase("scan-repository")
+		findings.Repository, err = trivyContainer.ScanRepository(state.ErrorStream)
+		endPhase()
+		if err != nil {
 			return fmt.Errorf("cdflow2: error scanning repository: %w", err)
 		}
+
+		if trivyContainer.Config().InfraScan() {
+			endPhase := state.Result.StartPhase("scan-infra")
+			findings.Infra, err = trivyContainer.ScanInfra(config.ConfigFiles(state, ""), state.ErrorStream)
+			endPhase()
+			if err != nil {
+				return fmt.Errorf("cdflow2: error scanning infra: %w", err)
+			}
+		}
 	}
 
 	dockerClient := state.DockerClient
@@ -279,7 +351,11 @@ func RunCommand(state *command.GlobalState, releaseArgs CommandArgs, env map[str
 	}()
 
 	go func() {
-		savedTerraformImage, err := terraformRelease(state, buildVolume, terraformOutputStream, terraformErrorStream, releaseArgs.TerraformLogLevel)
+		endPhase := state.Result.StartPhase("terraform")
+		savedTerraformImage, err := terraformRelease(ctx, state, buildVolume, terraformOutputStream, terraformErrorStream, releaseArgs.TerraformLogLevel)
+		if err == nil {
+			endPhase()
+		}
 		terraformOutputStream.Close()
 		terraformErrorStream.Close()
 		terraformResultChan <- &terraformResult{savedTerraformImage, err}
@@ -291,12 +367,13 @@ func RunCommand(state *command.GlobalState, releaseArgs CommandArgs, env map[str
 	}
 
 	message, err := buildAndUploadRelease(
+		ctx,
 		state,
 		buildVolume,
-		releaseArgs.Version,
-		releaseArgs.ReleaseData,
+		&releaseArgs,
+		builds,
 		trivyContainer,
-		&criticalSecurityFindings,
+		findings,
 		terraformResultChan,
 		terraformOutputChan,
 		env)
@@ -307,7 +384,15 @@ func RunCommand(state *command.GlobalState, releaseArgs CommandArgs, env map[str
 	if state.MonitoringClient.ConfigData == nil {
 		state.MonitoringClient.ConfigData = make(map[string]string)
 	}
-	state.MonitoringClient.ConfigData[MONITORING_SECURITY_FINDINGS] = strconv.FormatBool(criticalSecurityFindings)
+	state.MonitoringClient.ConfigData[MONITORING_SECURITY_FINDINGS] = strconv.FormatBool(findings.Fail())
+
+	if state.Manifest.Trivy.Image != "" {
+		fmt.Fprint(state.ErrorStream, "\ncdflow2: security findings...\n\n")
+		if err := trivy.WriteFindingsTable(state.ErrorStream, findings.Table()); err != nil {
+			return err
+		}
+		fmt.Fprintln(state.ErrorStream)
+	}
 
 	// not in the above function to ensure docker output flushed before that finishes
 	fmt.Fprintln(state.ErrorStream, message)
@@ -316,23 +401,25 @@ func RunCommand(state *command.GlobalState, releaseArgs CommandArgs, env map[str
 }
 
 func buildAndUploadRelease(
+	ctx context.Context,
 	state *command.GlobalState,
-	buildVolume,
-	version string,
-	releaseData map[string]string,
+	buildVolume string,
+	releaseArgs *CommandArgs,
+	builds map[string]manifest.ImageWithParamsAndEnvVars,
 	trivyContainer *trivy.Container,
-	criticalSecurityFindings *bool,
+	findings *trivy.ReleaseFindings,
 	terraformResultChan chan *terraformResult,
 	terraformOutputChan chan *output,
 	env map[string]string) (returnedMessage string, returnedError error) {
 
-	releaseRequirements, err := GetReleaseRequirements(state)
+	endPhase := state.Result.StartPhase("release-requirements")
+	releaseRequirements, err := GetReleaseRequirements(ctx, state, builds)
 	if err != nil {
 		return "", err
 	}
+	endPhase()
 
-	dockerClient := state.DockerClient
-	configContainer, err := config.NewContainer(state, state.Manifest.Config.Image, buildVolume)
+	configContainer, err := config.NewContainer(ctx, state, state.Manifest.Config.Image, buildVolume)
 	if err != nil {
 		return "", err
 	}
@@ -347,8 +434,11 @@ func buildAndUploadRelease(
 		}
 	}()
 
-	fmt.Print("\ncdflow2: getting release configuration...\n\n")
+	fmt.Fprint(state.ErrorStream, "\ncdflow2: getting release configuration...\n\n")
 
+	version := releaseArgs.Version
+
+	endPhase = state.Result.StartPhase("configure-release")
 	configureReleaseResponse, err := configContainer.ConfigureRelease(
 		version,
 		state.Component,
@@ -360,6 +450,7 @@ func buildAndUploadRelease(
 	if err != nil {
 		return "", err
 	}
+	endPhase()
 
 	releaseEnv := configureReleaseResponse.Env
 	state.MonitoringClient.APIKey = configureReleaseResponse.Monitoring.APIKey
@@ -369,64 +460,73 @@ func buildAndUploadRelease(
 	releaseMetadata["release"] = make(map[string]string)
 	releaseMetadata["release"]["tags"] = getReleaseTagsInfo(env)
 
-	for buildID, build := range state.Manifest.Builds {
-		env := releaseEnv[buildID]
-
-		if env == nil {
-			env = make(map[string]string)
-		}
-
-		// Inject build env bars into release container
-		PopulateEnvMap(build.EnvVars, env)
-
-		// these are built in and cannot be overridden by the config container (since choosing the clashing name would likely be an accident)
-		env["VERSION"] = version
-		env["COMPONENT"] = state.Component
-		env["COMMIT"] = state.Commit
-		env["BUILD_ID"] = buildID
-		manifestParams, err := json.Marshal(build.Params)
-		if err != nil {
-			return "", err
-		}
-		env["MANIFEST_PARAMS"] = string(manifestParams)
-		metadata, err := container.Run(
-			dockerClient,
-			build.Image,
-			state.CodeDir,
-			buildVolume,
-			state.OutputStream,
-			state.ErrorStream,
-			env,
-		)
+	sboms := make(map[string][]byte)
+	if state.Manifest.Trivy.Image != "" && trivyContainer.Config().SBOM() {
+		endPhase := state.Result.StartPhase("sbom/repository")
+		sbom, err := trivyContainer.RepositorySBOM(state.ErrorStream)
 		if err != nil {
-			return "", fmt.Errorf("cdflow2: error running build '%v' - %w", buildID, err)
-		}
-		releaseMetadata[buildID] = metadata
-
-		if image, ok := metadata["image"]; ok {
-			securityFindings := false
-			if state.Manifest.Trivy.Image != "" {
-				if securityFindings, err = trivyContainer.ScanImage(image, state.OutputStream, state.ErrorStream); err != nil {
-					return "", fmt.Errorf("cdflow2: error scanning image '%v' - %w", buildID, err)
-				}
-				*criticalSecurityFindings = *criticalSecurityFindings || securityFindings
-			}
+			return "", fmt.Errorf("cdflow2: error generating SBOM for repository - %w", err)
 		}
+		endPhase()
+		sboms[trivyContainer.SBOMFilename("sbom/repository")] = sbom
+	}
+
+	runner := &buildRunner{
+		state:           state,
+		buildVolume:     buildVolume,
+		version:         version,
+		releaseEnv:      releaseEnv,
+		trivyContainer:  trivyContainer,
+		parallelism:     releaseArgs.Parallelism,
+		releaseMetadata: releaseMetadata,
+		findings:        findings,
+		sboms:           sboms,
+	}
+	if err := runner.run(ctx, builds); err != nil {
+		return "", err
 	}
 	releaseMetadata["release"]["version"] = version
 	releaseMetadata["release"]["commit"] = state.Commit
 	releaseMetadata["release"]["component"] = state.Component
-	for k, v := range releaseData {
+	for k, v := range releaseArgs.ReleaseData {
 		releaseMetadata["release"][k] = v
 	}
 	for k, v := range configureReleaseResponse.AdditionalMetadata {
 		releaseMetadata["release"][k] = v
 	}
+	if state.Manifest.Trivy.Image != "" {
+		encodedFindings, err := json.Marshal(findings)
+		if err != nil {
+			return "", err
+		}
+		releaseMetadata["release"][trivy.RELEASE_METADATA_FINDINGS] = string(encodedFindings)
+	}
+	if len(builds) < len(state.Manifest.Builds) {
+		buildIDs := make([]string, 0, len(builds))
+		for buildID := range builds {
+			buildIDs = append(buildIDs, buildID)
+		}
+		sort.Strings(buildIDs)
+		releaseMetadata["release"]["partial"] = "true"
+		releaseMetadata["release"]["builds"] = strings.Join(buildIDs, ",")
+	}
 
 	if err := configContainer.WriteReleaseMetadata(releaseMetadata); err != nil {
 		return "", err
 	}
 
+	sbomFilenames := make([]string, 0, len(sboms))
+	for filename := range sboms {
+		sbomFilenames = append(sbomFilenames, filename)
+	}
+	sort.Strings(sbomFilenames)
+	for _, filename := range sbomFilenames {
+		fmt.Fprintf(state.ErrorStream, "cdflow2: adding %s to release\n", filename)
+		if err := configContainer.CopyFileToRelease(filename, sboms[filename]); err != nil {
+			return "", err
+		}
+	}
+
 	terraformResult := <-terraformResultChan
 	if err := streamOutput(terraformOutputChan, state.OutputStream, state.ErrorStream); err != nil {
 		return "", err
@@ -448,29 +548,44 @@ func buildAndUploadRelease(
 
 	}
 
-	fmt.Print("\ncdflow2: uploading release...\n\n")
+	if releaseArgs.ExportDir != "" {
+		fmt.Fprintf(state.ErrorStream, "\ncdflow2: exporting release to %s...\n\n", releaseArgs.ExportDir)
+		if err := configContainer.ExportRelease(releaseArgs.ExportDir); err != nil {
+			return "", fmt.Errorf("error exporting release: %w", err)
+		}
+	}
+
+	if releaseArgs.DryRun {
+		state.Result.SetRelease(releaseMetadata, "")
+		return "cdflow2: dry run, release not uploaded", nil
+	}
+
+	fmt.Fprint(state.ErrorStream, "\ncdflow2: uploading release...\n\n")
 
+	endPhase = state.Result.StartPhase("upload")
 	uploadReleaseResponse, err := configContainer.UploadRelease(
 		terraformResult.savedTerraformImage,
 	)
 	if err != nil {
 		return "", fmt.Errorf("error uploading release: %w", err)
 	}
+	endPhase()
+	state.Result.SetRelease(releaseMetadata, uploadReleaseResponse.Message)
 
 	return uploadReleaseResponse.Message, nil
 }
 
-// GetReleaseRequirements runs the release containers in order to get their requirements.
-func GetReleaseRequirements(state *command.GlobalState) (map[string]*config.ReleaseRequirements, error) {
+// GetReleaseRequirements runs the release containers for builds in order to get their requirements.
+func GetReleaseRequirements(ctx context.Context, state *command.GlobalState, builds map[string]manifest.ImageWithParamsAndEnvVars) (map[string]*config.ReleaseRequirements, error) {
 	result := make(map[string]*config.ReleaseRequirements)
-	for buildID, build := range state.Manifest.Builds {
+	for buildID, build := range builds {
 		if !state.GlobalArgs.NoPullRelease {
 			fmt.Fprintf(state.ErrorStream, "\nPulling build image (%v): %v...\n\n", buildID, build.Image)
 			if err := state.DockerClient.PullImage(build.Image, state.ErrorStream); err != nil {
 				return nil, fmt.Errorf("error pulling build image (%v): %w", buildID, err)
 			}
 		}
-		requirements, err := container.GetReleaseRequirements(state, buildID, build.Image, state.ErrorStream)
+		requirements, err := container.GetReleaseRequirements(ctx, state, buildID, build.Image, state.ErrorStream)
 		if err != nil {
 			return nil, err
 		}
@@ -509,7 +624,7 @@ func getReleaseTagsInfo(env map[string]string) string {
 	return string(tagsBuff)
 }
 
-func GetScanContainer(state *command.GlobalState, releaseArgs CommandArgs) (*trivy.Container, error) {
+func GetScanContainer(ctx context.Context, state *command.GlobalState, releaseArgs CommandArgs) (*trivy.Container, error) {
 	dockerClient := state.DockerClient
 	image := state.Manifest.Trivy.Image
 
@@ -520,6 +635,7 @@ func GetScanContainer(state *command.GlobalState, releaseArgs CommandArgs) (*tri
 		}
 	}
 	trivyConatiner, err := trivy.NewContainer(
+		ctx,
 		dockerClient,
 		image,
 		state.CodeDir,
@@ -2,11 +2,13 @@ package command_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"io"
 	"log"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 
@@ -95,6 +97,61 @@ func TestParseArgsWhenEnv(t *testing.T) {
 
 	})
 
+	t.Run("--dry-run and --export-dir", func(t *testing.T) {
+		args := []string{"-n", "--export-dir", "release-contents", "version1"}
+
+		gotArgs, gotError := release.ParseArgs(args)
+
+		var wantArgs release.CommandArgs
+		wantArgs.Version = "version1"
+
+		assertMatchArgs(t, gotArgs, &wantArgs)
+		assertError(t, gotError, nil)
+		if !gotArgs.DryRun {
+			t.Error("DryRun: got false want true")
+		}
+		if gotArgs.ExportDir != "release-contents" {
+			t.Errorf("ExportDir: got %s want release-contents", gotArgs.ExportDir)
+		}
+
+	})
+
+	t.Run("--only, --skip and --no-partial-upload", func(t *testing.T) {
+		args := []string{"--only", "a", "--only=b", "--skip", "c", "--no-partial-upload", "version1"}
+
+		gotArgs, gotError := release.ParseArgs(args)
+
+		assertError(t, gotError, nil)
+		if !reflect.DeepEqual(gotArgs.Only, []string{"a", "b"}) {
+			t.Errorf("Only: got %v want [a b]", gotArgs.Only)
+		}
+		if !reflect.DeepEqual(gotArgs.Skip, []string{"c"}) {
+			t.Errorf("Skip: got %v want [c]", gotArgs.Skip)
+		}
+		if !gotArgs.NoPartialUpload {
+			t.Error("NoPartialUpload: got false want true")
+		}
+
+	})
+
+	t.Run("--parallelism", func(t *testing.T) {
+		gotArgs, gotError := release.ParseArgs([]string{"version1"})
+		assertError(t, gotError, nil)
+		if gotArgs.Parallelism != 1 {
+			t.Errorf("Parallelism: got %d want 1 by default", gotArgs.Parallelism)
+		}
+
+		gotArgs, gotError = release.ParseArgs([]string{"-p", "4", "version1"})
+		assertError(t, gotError, nil)
+		if gotArgs.Parallelism != 4 {
+			t.Errorf("Parallelism: got %d want 4", gotArgs.Parallelism)
+		}
+
+		_, gotError = release.ParseArgs([]string{"--parallelism", "0", "version1"})
+		assertError(t, gotError, errors.New("parallelism must be a positive number: 0"))
+
+	})
+
 	t.Run("--release-data in wrong format", func(t *testing.T) {
 		args := []string{"--release-data", "foo:bar", "version1"}
 
@@ -141,6 +198,7 @@ func TestRunCommand(t *testing.T) {
 
 	// When
 	if err := release.RunCommand(
+		context.Background(),
 		&command.GlobalState{
 			DockerClient: dockerClient,
 			Component:    "test-component",
@@ -285,6 +343,58 @@ func checkUploadReleaseOutput(t *testing.T, debugOutput []byte) {
 	}
 }
 
+func TestSelectBuilds(t *testing.T) {
+	builds := map[string]manifest.ImageWithParamsAndEnvVars{
+		"a": {Image: "image-a"},
+		"b": {Image: "image-b"},
+		"c": {Image: "image-c"},
+	}
+	selected := func(only, skip []string) []string {
+		t.Helper()
+		result, err := release.SelectBuilds(builds, only, skip)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var buildIDs []string
+		for buildID := range result {
+			buildIDs = append(buildIDs, buildID)
+		}
+		sort.Strings(buildIDs)
+		return buildIDs
+	}
+
+	for name, tc := range map[string]struct {
+		only, skip []string
+		want       []string
+	}{
+		"all":           {want: []string{"a", "b", "c"}},
+		"only":          {only: []string{"a", "c"}, want: []string{"a", "c"}},
+		"skip":          {skip: []string{"b"}, want: []string{"a", "c"}},
+		"only and skip": {only: []string{"a", "b"}, skip: []string{"b"}, want: []string{"a"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := selected(tc.only, tc.skip); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := release.SelectBuilds(builds, []string{"d"}, nil); err == nil {
+		t.Error("expected error for unknown build")
+	}
+	if _, err := release.SelectBuilds(builds, []string{"a"}, []string{"a"}); err == nil {
+		t.Error("expected error when no builds are selected")
+	}
+
+	builds["c"] = manifest.ImageWithParamsAndEnvVars{Image: "image-c", DependsOn: []string{"a"}}
+	if _, err := release.SelectBuilds(builds, nil, []string{"a"}); err == nil {
+		t.Error("expected error when a dependency is not selected")
+	}
+	if got := selected([]string{"a", "c"}, nil); !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Errorf("got %v, want [a c]", got)
+	}
+}
+
 func TestPopulateEnvMap(t *testing.T) {
 
 	// Set environment variable EXISTING_VAR
@@ -297,28 +407,10 @@ func TestPopulateEnvMap(t *testing.T) {
 	envVars := []string{"EXISTING_VAR", "MISSING_VAR"}
 	env := make(map[string]string)
 
-	// Setup the ability to capture stdout
-	reader, writer, err := os.Pipe()
-	if err != nil {
-		t.Fatalf("Failed to create pipe: %v", err)
-	}
-
-	// Start stdout capture
-	originalStdout := os.Stdout
-	os.Stdout = writer
-
-	release.PopulateEnvMap(envVars, env)
-
-	// end stdout capture
-	writer.Close()
-	os.Stdout = originalStdout
-
-	// Read the captured output
+	// capture the output
 	var buf bytes.Buffer
-	_, err = io.Copy(&buf, reader)
-	if err != nil {
-		t.Fatalf("Failed to read stdout: %v", err)
-	}
+
+	release.PopulateEnvMap(envVars, env, &buf)
 
 	// Check if EXISTING_VAR env var are in the env map and the value is correct.
 	if env["EXISTING_VAR"] != "test_value" {
@@ -3,6 +3,7 @@ package container
 import (
 	"archive/tar"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,9 +16,9 @@ import (
 )
 
 // GetReleaseRequirements runs the container in order to get requirements.
-func GetReleaseRequirements(state *command.GlobalState, buildID, image string, errorStream io.Writer) (*config.ReleaseRequirements, error) {
+func GetReleaseRequirements(ctx context.Context, state *command.GlobalState, buildID, image string, errorStream io.Writer) (*config.ReleaseRequirements, error) {
 	var outputBuffer bytes.Buffer
-	if err := state.DockerClient.Run(&docker.RunOptions{
+	if err := state.DockerClient.Run(ctx, &docker.RunOptions{
 		Image:        image,
 		OutputStream: &outputBuffer,
 		ErrorStream:  errorStream,
@@ -34,11 +35,11 @@ func GetReleaseRequirements(state *command.GlobalState, buildID, image string, e
 }
 
 // Run creates and runs the release container, returning a map of release metadata.
-func Run(dockerClient docker.Iface, image, codeDir, buildVolume string, outputStream, errorStream io.Writer, env map[string]string) (map[string]string, error) {
+func Run(ctx context.Context, dockerClient docker.Iface, image, codeDir, buildVolume string, outputStream, errorStream io.Writer, env map[string]string) (map[string]string, error) {
 
 	var releaseMetadata map[string]string
 
-	return releaseMetadata, dockerClient.Run(&docker.RunOptions{
+	return releaseMetadata, dockerClient.Run(ctx, &docker.RunOptions{
 		Image:        image,
 		OutputStream: outputStream,
 		ErrorStream:  errorStream,
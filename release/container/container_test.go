@@ -2,6 +2,7 @@ package container_test
 
 import (
 	"bytes"
+	"context"
 	"reflect"
 	"testing"
 
@@ -23,6 +24,7 @@ func TestRelese(t *testing.T) {
 
 	// When
 	releaseMetadata, err := container.Run(
+		context.Background(),
 		dockerClient,
 		test.GetConfig("TEST_RELEASE_IMAGE"),
 		codeDir,
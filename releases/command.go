@@ -0,0 +1,153 @@
+package releases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/mergermarket/cdflow2/command"
+	"github.com/mergermarket/cdflow2/config"
+)
+
+// CommandArgs contains specific arguments to the releases command.
+type CommandArgs struct {
+	Subcommand string
+	Version    string
+}
+
+// NewArgParser returns the parser for the releases options and arguments, which sets result.
+func NewArgParser(result *CommandArgs) *command.ArgParser {
+	return &command.ArgParser{
+		Name: "releases",
+		HandleArg: func(arg string) (bool, error) {
+			if result.Subcommand == "" {
+				if arg != "list" && arg != "show" {
+					return false, errors.New("unknown releases subcommand: " + arg)
+				}
+				result.Subcommand = arg
+			} else if result.Subcommand == "show" && result.Version == "" {
+				result.Version = arg
+			} else {
+				return false, errors.New("unknown releases argument: " + arg)
+			}
+			return false, nil
+		},
+	}
+}
+
+// ParseArgs parses command line arguments to the releases subcommand.
+func ParseArgs(args []string) (*CommandArgs, error) {
+	var result CommandArgs
+
+	parser := NewArgParser(&result)
+	if _, err := parser.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if result.Subcommand == "" {
+		return nil, errors.New("releases subcommand is missing (list or show)")
+	}
+
+	if result.Subcommand == "show" && result.Version == "" {
+		return nil, errors.New("version argument is missing")
+	}
+
+	return &result, nil
+}
+
+// RunCommand runs the releases command.
+func RunCommand(ctx context.Context, state *command.GlobalState, args *CommandArgs, env map[string]string) (returnedError error) {
+	if err := config.Pull(state); err != nil {
+		return err
+	}
+
+	// output from the config container goes to stderr so that stdout only contains the releases
+	containerState := *state
+	containerState.OutputStream = state.ErrorStream
+
+	configContainer, err := config.NewContainer(ctx, &containerState, state.Manifest.Config.Image, "")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := configContainer.Done(); err != nil {
+			if returnedError != nil {
+				returnedError = fmt.Errorf("%w, also %v", returnedError, err)
+			} else {
+				returnedError = err
+			}
+			return
+		}
+	}()
+
+	outputJSON := state.GlobalArgs.Output == command.OutputJSON
+
+	if args.Subcommand == "list" {
+		response, err := configContainer.ListReleases(state.Component, state.Manifest.Config.Params, env)
+		if err != nil {
+			return err
+		}
+		if outputJSON {
+			return writeJSON(state.OutputStream, response.Releases)
+		}
+		return WriteReleaseList(state.OutputStream, response.Releases)
+	}
+
+	response, err := configContainer.GetRelease(args.Version, state.Component, state.Manifest.Config.Params, env)
+	if err != nil {
+		return err
+	}
+	if outputJSON {
+		return writeJSON(state.OutputStream, response.Release)
+	}
+	return WriteRelease(state.OutputStream, response.Release)
+}
+
+func writeJSON(outputStream io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(outputStream)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// WriteReleaseList writes a table of releases.
+func WriteReleaseList(outputStream io.Writer, releases []*config.Release) error {
+	writer := tabwriter.NewWriter(outputStream, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tCOMMIT\tCREATED")
+	for _, release := range releases {
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", release.Version, release.Commit, release.Created)
+	}
+	return writer.Flush()
+}
+
+// WriteRelease writes the details of a release, including the metadata for each build.
+func WriteRelease(outputStream io.Writer, release *config.Release) error {
+	fmt.Fprintf(outputStream, "Version: %s\n", release.Version)
+	fmt.Fprintf(outputStream, "Commit:  %s\n", release.Commit)
+	fmt.Fprintf(outputStream, "Created: %s\n", release.Created)
+	for _, buildID := range sortedKeys(release.Metadata) {
+		fmt.Fprintf(outputStream, "\n%s:\n", buildID)
+		metadata := release.Metadata[buildID]
+		keys := make([]string, 0, len(metadata))
+		for key := range metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(outputStream, "  %s = %s\n", key, metadata[key])
+		}
+	}
+	return nil
+}
+
+func sortedKeys(input map[string]map[string]string) []string {
+	keys := make([]string, 0, len(input))
+	for key := range input {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,82 @@
+package releases_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/config"
+	"github.com/mergermarket/cdflow2/releases"
+)
+
+func TestParseArgs(t *testing.T) {
+	t.Run("list", func(t *testing.T) {
+		args, err := releases.ParseArgs([]string{"list"})
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if args.Subcommand != "list" {
+			t.Errorf("Subcommand: got %s want list", args.Subcommand)
+		}
+	})
+
+	t.Run("show", func(t *testing.T) {
+		args, err := releases.ParseArgs([]string{"show", "34-abc"})
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if args.Subcommand != "show" || args.Version != "34-abc" {
+			t.Errorf("got %s %s want show 34-abc", args.Subcommand, args.Version)
+		}
+	})
+
+	for name, args := range map[string][]string{
+		"no subcommand":      {},
+		"unknown subcommand": {"delete"},
+		"show no version":    {"show"},
+		"list with version":  {"list", "1"},
+		"unknown option":     {"-o", "json", "list"},
+	} {
+		t.Run("sad path - "+name, func(t *testing.T) {
+			if _, err := releases.ParseArgs(args); err == nil {
+				t.Error("Error expected, but got nil")
+			}
+		})
+	}
+}
+
+func TestWriteReleaseList(t *testing.T) {
+	var output bytes.Buffer
+	if err := releases.WriteReleaseList(&output, []*config.Release{
+		{Version: "2", Commit: "bbb", Created: "2024-01-02T00:00:00Z"},
+		{Version: "1", Commit: "aaa", Created: "2024-01-01T00:00:00Z"},
+	}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	expected := "VERSION  COMMIT  CREATED\n" +
+		"2        bbb     2024-01-02T00:00:00Z\n" +
+		"1        aaa     2024-01-01T00:00:00Z\n"
+	if output.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", output.String(), expected)
+	}
+}
+
+func TestWriteRelease(t *testing.T) {
+	var output bytes.Buffer
+	if err := releases.WriteRelease(&output, &config.Release{
+		Version: "1",
+		Commit:  "aaa",
+		Created: "2024-01-01T00:00:00Z",
+		Metadata: map[string]map[string]string{
+			"release": {"version": "1", "commit": "aaa"},
+			"docker":  {"image": "repo/image@sha256:123"},
+		},
+	}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	expected := "Version: 1\nCommit:  aaa\nCreated: 2024-01-01T00:00:00Z\n" +
+		"\ndocker:\n  image = repo/image@sha256:123\n" +
+		"\nrelease:\n  commit = aaa\n  version = 1\n"
+	if output.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", output.String(), expected)
+	}
+}
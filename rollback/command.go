@@ -0,0 +1,159 @@
+package rollback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/mergermarket/cdflow2/command"
+	"github.com/mergermarket/cdflow2/config"
+	"github.com/mergermarket/cdflow2/deploy"
+	"github.com/mergermarket/cdflow2/util"
+)
+
+// CommandArgs contains specific arguments to the rollback command.
+type CommandArgs struct {
+	EnvName           string
+	Steps             int
+	PlanOnly          bool
+	TerraformLogLevel string
+	Force             bool
+	AcceptFindings    bool
+}
+
+// NewArgParser returns the parser for the rollback options and arguments, which sets result.
+func NewArgParser(result *CommandArgs) *command.ArgParser {
+	return &command.ArgParser{
+		Name: "rollback",
+		Options: []command.Option{
+			command.Value("steps", "s", func(value string) error {
+				steps, err := strconv.Atoi(value)
+				if err != nil || steps < 1 {
+					return errors.New("steps must be a positive integer: " + value)
+				}
+				result.Steps = steps
+				return nil
+			}),
+			command.Flag("plan-only", "p", func() { result.PlanOnly = true }),
+			// never defaulted, so that overriding a lock is always an explicit choice
+			{Long: "force", Short: "f", NoDefault: true, Handle: func(string) error {
+				result.Force = true
+				return nil
+			}},
+			command.StringValue("terraform-log-level", "t", &result.TerraformLogLevel),
+			{Long: "accept-findings", NoDefault: true, Handle: func(string) error {
+				result.AcceptFindings = true
+				return nil
+			}},
+		},
+		HandleArg: func(arg string) (bool, error) {
+			if result.EnvName == "" {
+				result.EnvName = arg
+			} else {
+				return false, errors.New("unknown rollback argument: " + arg)
+			}
+			return false, nil
+		},
+	}
+}
+
+// ParseArgs parses command line arguments to the rollback subcommand.
+func ParseArgs(args []string) (*CommandArgs, error) {
+	var result CommandArgs
+	result.Steps = 1
+
+	parser := NewArgParser(&result)
+	if _, err := parser.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if result.EnvName == "" {
+		return nil, errors.New("env argument is missing")
+	}
+
+	return &result, nil
+}
+
+// PickVersion picks the version to roll back to from a deployment history (most recent first), skipping
+// repeated deployments of the same version so that each step goes back to a different version, earlier deployments of
+// the version that is currently deployed, and deployments that failed.
+func PickVersion(deployments []*config.Deployment, steps int) (string, error) {
+	if len(deployments) == 0 {
+		return "", errors.New("no deployment history exists for this environment")
+	}
+	deployed := deployments[0].Version
+	current := deployed
+	remaining := steps
+	for _, deployment := range deployments[1:] {
+		// the current version may have failed to deploy, but never roll back to a version that did
+		if deployment.Version == current || deployment.Version == deployed || !deployment.Succeeded() {
+			continue
+		}
+		current = deployment.Version
+		remaining--
+		if remaining == 0 {
+			return current, nil
+		}
+	}
+	return "", fmt.Errorf("cannot roll back %d step(s), only %d earlier version(s) in the deployment history", steps, steps-remaining)
+}
+
+func getDeployments(ctx context.Context, state *command.GlobalState, envName string, env map[string]string) (_ []*config.Deployment, returnedError error) {
+	if err := config.Pull(state); err != nil {
+		return nil, err
+	}
+
+	configContainer, err := config.NewContainer(ctx, state, state.Manifest.Config.Image, "")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := configContainer.Done(); err != nil {
+			if returnedError != nil {
+				returnedError = fmt.Errorf("%w, also %v", returnedError, err)
+			} else {
+				returnedError = err
+			}
+			return
+		}
+	}()
+
+	response, err := configContainer.ListDeployments(state.Component, envName, state.Manifest.Config.Params, env)
+	if err != nil {
+		return nil, err
+	}
+	return response.Deployments, nil
+}
+
+// RunCommand runs the rollback command.
+func RunCommand(ctx context.Context, state *command.GlobalState, args *CommandArgs, env map[string]string) error {
+	deployments, err := getDeployments(ctx, state, args.EnvName, env)
+	if err != nil {
+		return err
+	}
+
+	version, err := PickVersion(deployments, args.Steps)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(
+		state.ErrorStream,
+		"\n%s\n",
+		util.FormatInfo(fmt.Sprintf("rolling back %s from version %s to version %s", args.EnvName, deployments[0].Version, version)),
+	)
+
+	state.MonitoringClient.ReleaseVersion = version
+
+	var T = true
+	return deploy.RunCommand(ctx, state, &deploy.CommandArgs{
+		EnvName:           args.EnvName,
+		Version:           version,
+		PlanOnly:          args.PlanOnly,
+		TerraformLogLevel: args.TerraformLogLevel,
+		StateShouldExist:  &T,
+		Force:             args.Force,
+		AcceptFindings:    args.AcceptFindings,
+	}, env)
+}
@@ -0,0 +1,156 @@
+package rollback_test
+
+import (
+	"testing"
+
+	"github.com/mergermarket/cdflow2/config"
+	"github.com/mergermarket/cdflow2/rollback"
+)
+
+func TestParseArgs(t *testing.T) {
+	t.Run("env only", func(t *testing.T) {
+		args, err := rollback.ParseArgs([]string{"live"})
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if args.EnvName != "live" {
+			t.Errorf("EnvName: got %s want live", args.EnvName)
+		}
+		if args.Steps != 1 {
+			t.Errorf("Steps: got %d want 1", args.Steps)
+		}
+	})
+
+	t.Run("steps + plan-only", func(t *testing.T) {
+		args, err := rollback.ParseArgs([]string{"--steps", "3", "-p", "live"})
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if args.Steps != 3 {
+			t.Errorf("Steps: got %d want 3", args.Steps)
+		}
+		if !args.PlanOnly {
+			t.Error("PlanOnly: got false want true")
+		}
+	})
+
+	t.Run("force", func(t *testing.T) {
+		args, err := rollback.ParseArgs([]string{"live", "--force"})
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if !args.Force {
+			t.Error("Force: got false want true")
+		}
+	})
+
+	t.Run("force isn't defaulted from the environment", func(t *testing.T) {
+		t.Setenv("CDFLOW2_FORCE", "true")
+		args, err := rollback.ParseArgs([]string{"live"})
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if args.Force {
+			t.Error("Force: got true want false")
+		}
+	})
+
+	t.Run("accept-findings", func(t *testing.T) {
+		args, err := rollback.ParseArgs([]string{"--accept-findings", "live"})
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if !args.AcceptFindings {
+			t.Error("AcceptFindings: got false want true")
+		}
+	})
+
+	t.Run("sad path - no env", func(t *testing.T) {
+		if _, err := rollback.ParseArgs([]string{}); err == nil {
+			t.Error("Error expected, but got nil")
+		}
+	})
+
+	t.Run("sad path - invalid steps", func(t *testing.T) {
+		if _, err := rollback.ParseArgs([]string{"-s", "0", "live"}); err == nil {
+			t.Error("Error expected, but got nil")
+		}
+	})
+
+	t.Run("sad path - too many args", func(t *testing.T) {
+		if _, err := rollback.ParseArgs([]string{"live", "1"}); err == nil {
+			t.Error("Error expected, but got nil")
+		}
+	})
+}
+
+func TestPickVersion(t *testing.T) {
+	deployments := []*config.Deployment{
+		{Version: "3"},
+		{Version: "3"},
+		{Version: "2"},
+		{Version: "1"},
+	}
+
+	t.Run("previous version", func(t *testing.T) {
+		version, err := rollback.PickVersion(deployments, 1)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if version != "2" {
+			t.Errorf("got %s want 2", version)
+		}
+	})
+
+	t.Run("two steps", func(t *testing.T) {
+		version, err := rollback.PickVersion(deployments, 2)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if version != "1" {
+			t.Errorf("got %s want 1", version)
+		}
+	})
+
+	t.Run("skips earlier deployments of the deployed version", func(t *testing.T) {
+		version, err := rollback.PickVersion([]*config.Deployment{
+			{Version: "3"},
+			{Version: "2"},
+			{Version: "3"},
+			{Version: "1"},
+		}, 2)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if version != "1" {
+			t.Errorf("got %s want 1", version)
+		}
+	})
+
+	t.Run("skips failed deployments", func(t *testing.T) {
+		version, err := rollback.PickVersion([]*config.Deployment{
+			{Version: "4", Outcome: config.OutcomeFailure},
+			{Version: "3", Outcome: config.OutcomeSuccess},
+			{Version: "2", Outcome: config.OutcomeFailure},
+			{Version: "1", Outcome: config.OutcomeSuccess},
+		}, 2)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if version != "1" {
+			t.Errorf("got %s want 1", version)
+		}
+	})
+
+	t.Run("sad path - not enough history", func(t *testing.T) {
+		if _, err := rollback.PickVersion(deployments, 3); err == nil {
+			t.Error("Error expected, but got nil")
+		}
+	})
+
+	t.Run("sad path - no history", func(t *testing.T) {
+		if _, err := rollback.PickVersion(nil, 1); err == nil {
+			t.Error("Error expected, but got nil")
+		}
+	})
+}
@@ -1,19 +1,26 @@
 package setup
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/mergermarket/cdflow2/command"
 	"github.com/mergermarket/cdflow2/config"
 	release "github.com/mergermarket/cdflow2/release/command"
+	"github.com/mergermarket/cdflow2/util"
+	"github.com/mergermarket/cdflow2/validate"
 )
 
 // RunCommand runs the setup command.
-func RunCommand(state *command.GlobalState, env map[string]string) (returnedError error) {
+func RunCommand(ctx context.Context, state *command.GlobalState, env map[string]string) (returnedError error) {
 
-	// TODO check cdflow.yaml setup
+	for _, problem := range validate.Check(state.CodeDir) {
+		fmt.Fprintf(state.ErrorStream, "%s\n", util.FormatWarning(problem))
+	}
 
-	releaseRequirements, err := release.GetReleaseRequirements(state)
+	endPhase := state.Result.StartPhase("release-requirements")
+	releaseRequirements, err := release.GetReleaseRequirements(ctx, state, state.Manifest.Builds)
+	endPhase()
 	if err != nil {
 		return err
 	}
@@ -22,7 +29,7 @@ func RunCommand(state *command.GlobalState, env map[string]string) (returnedErro
 		return err
 	}
 
-	configContainer, err := config.NewContainer(state, state.Manifest.Config.Image, "")
+	configContainer, err := config.NewContainer(ctx, state, state.Manifest.Config.Image, "")
 	if err != nil {
 		return err
 	}
@@ -37,7 +44,9 @@ func RunCommand(state *command.GlobalState, env map[string]string) (returnedErro
 		}
 	}()
 
+	endPhase = state.Result.StartPhase("setup")
 	response, err := configContainer.Setup(state.Manifest.Config.Params, env, state.Component, state.Commit, releaseRequirements)
+	endPhase()
 	if err != nil {
 		return err
 	}
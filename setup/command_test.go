@@ -2,6 +2,7 @@ package setup_test
 
 import (
 	"bytes"
+	"context"
 	"log"
 	"strings"
 	"testing"
@@ -22,6 +23,7 @@ func TestRunCommand(t *testing.T) {
 
 	// When
 	if err := setup.RunCommand(
+		context.Background(),
 		&command.GlobalState{
 			DockerClient: dockerClient,
 			Component:    "test-component",
@@ -1,10 +1,10 @@
 package shell
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/mergermarket/cdflow2/command"
 	"github.com/mergermarket/cdflow2/config"
@@ -28,39 +28,23 @@ func isTty(stream os.File) bool {
 	return true
 }
 
-func handleArgs(arg string, commandArgs *CommandArgs, take func() (string, error)) (bool, error) {
-	if arg == "--" {
-		return true, nil
-	} else if strings.HasPrefix(arg, "-") {
-		return handleFlag(arg, commandArgs, take)
-	} else if commandArgs.EnvName == "" {
-		commandArgs.EnvName = arg
-		return false, nil
-	} else {
-		return false, errors.New("unexpected argument: " + arg)
-	}
-}
-
-func handleFlag(arg string, commandArgs *CommandArgs, take func() (string, error)) (bool, error) {
-	if arg == "-v" || arg == "--version" {
-		value, err := take()
-		if err != nil {
-			return false, err
-		}
-		commandArgs.Version = value
-	} else if strings.HasPrefix(arg, "--version=") {
-		commandArgs.Version = strings.TrimPrefix(arg, "--version=")
-	} else if arg == "-t" || arg == "--terraform-log-level" {
-		value, err := take()
-		if err != nil {
-			return false, err
-		}
-
-		commandArgs.TerraformLogLevel = value
-	} else {
-		return false, errors.New("unknown shell option: " + arg)
+// NewArgParser returns the parser for the shell options and arguments, which sets result.
+func NewArgParser(result *CommandArgs) *command.ArgParser {
+	return &command.ArgParser{
+		Name: "shell",
+		Options: []command.Option{
+			command.CommandLineOnly(command.StringValue("version", "v", &result.Version)),
+			command.StringValue("terraform-log-level", "t", &result.TerraformLogLevel),
+		},
+		HandleArg: func(arg string) (bool, error) {
+			if result.EnvName == "" {
+				result.EnvName = arg
+				return false, nil
+			}
+			return false, errors.New("unexpected argument: " + arg)
+		},
+		StopAtDoubleDash: true,
 	}
-	return false, nil
 }
 
 // ParseArgs parses command line arguments to the shell subcommand.
@@ -68,26 +52,14 @@ func ParseArgs(args []string) (*CommandArgs, error) {
 	var result CommandArgs
 	var T = true
 	result.StateShouldExist = &T // set default to true
-	i := 0
 
-	take := func() (string, error) {
-		i++
-		if i >= len(args) {
-			return "", errors.New("missing value")
-		}
-
-		return args[i], nil
+	parser := NewArgParser(&result)
+	shellArgs, err := parser.Parse(args)
+	if err != nil {
+		return nil, err
 	}
-
-	for ; i < len(args); i++ {
-		done, err := handleArgs(args[i], &result, take)
-		if err != nil {
-			return nil, err
-		}
-		if done {
-			result.ShellArgs = args[i+1:]
-			break
-		}
+	if len(shellArgs) > 0 {
+		result.ShellArgs = shellArgs
 	}
 
 	if result.EnvName == "" {
@@ -98,8 +70,8 @@ func ParseArgs(args []string) (*CommandArgs, error) {
 }
 
 // RunCommand runs the shell command.
-func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]string) (returnedError error) {
-	prepareTerraformResponse, buildVolume, terraformImage, err := config.SetupTerraform(state, args.StateShouldExist, args.EnvName, args.Version, env)
+func RunCommand(ctx context.Context, state *command.GlobalState, args *CommandArgs, env map[string]string) (returnedError error) {
+	prepareTerraformResponse, buildVolume, terraformImage, err := config.SetupTerraform(ctx, state, args.StateShouldExist, args.EnvName, args.Version, env)
 	if err != nil {
 		return err
 	}
@@ -115,6 +87,7 @@ func RunCommand(state *command.GlobalState, args *CommandArgs, env map[string]st
 	}()
 
 	terraformContainer, err := terraform.NewContainer(
+		ctx,
 		state.DockerClient,
 		terraformImage,
 		state.CodeDir,
@@ -2,6 +2,7 @@ package shell_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"reflect"
@@ -61,7 +62,7 @@ func TestRunCommand(t *testing.T) {
 	args, _ := shell.ParseArgs([]string{"test-env", "-v", "test-version", "--", "terraform", "-v"})
 
 	// When
-	if err := shell.RunCommand(state, args, map[string]string{
+	if err := shell.RunCommand(context.Background(), state, args, map[string]string{
 		"TERRAFORM_DIGEST": terraformDigest,
 	}); err != nil {
 		t.Fatal("error running shell command:", err, errorBuffer.String())
@@ -229,6 +230,19 @@ func TestParseArgsWhenEnv(t *testing.T) {
 
 	})
 
+	t.Run("version isn't defaulted from the environment", func(t *testing.T) {
+		t.Setenv("CDFLOW2_VERSION", "beta")
+		args := []string{"alfa"}
+
+		gotArgs, gotError := shell.ParseArgs(args)
+
+		var wantArgs shell.CommandArgs
+		wantArgs.EnvName = "alfa"
+
+		assertMatchArgs(t, gotArgs, &wantArgs)
+		assertError(t, gotError, nil)
+	})
+
 	t.Run("env and shellArgs", func(t *testing.T) {
 		args := []string{"alfa", "--", "beta"}
 
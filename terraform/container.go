@@ -2,6 +2,7 @@ package terraform
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -10,6 +11,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mergermarket/cdflow2/config"
 	"github.com/mergermarket/cdflow2/docker"
@@ -18,18 +20,25 @@ import (
 
 const (
 	terraformDataDir = "/build/.terraform"
+	// how long terraform is given to exit after being interrupted, so that it can release locks and save state
+	interruptTimeout = 30 * time.Second
 )
 
+// interruptCmd sends SIGINT to terraform, which makes it stop cleanly the same as Ctrl-C would when run directly.
+var interruptCmd = []string{"pkill", "-INT", "-x", "terraform"}
+
 // Container stores information about a running terraform container for running terraform commands in.
 type Container struct {
+	ctx          context.Context
 	dockerClient docker.Iface
 	id           string
 	done         chan error
 	codeDir      string
 }
 
-// NewContainer creates and returns a terraformContainer for running terraform commands in.
-func NewContainer(dockerClient docker.Iface, image, codeDir string, releaseVolume string, logLevel string) (*Container, error) {
+// NewContainer creates and returns a terraformContainer for running terraform commands in. If ctx is cancelled then
+// running terraform commands are interrupted, but the container itself keeps running until Done is called.
+func NewContainer(ctx context.Context, dockerClient docker.Iface, image, codeDir string, releaseVolume string, logLevel string) (*Container, error) {
 	infraDir := filepath.Join(codeDir, "infra")
 	if _, err := os.Stat(infraDir); err != nil {
 		if os.IsNotExist(err) {
@@ -55,7 +64,7 @@ func NewContainer(dockerClient docker.Iface, image, codeDir string, releaseVolum
 	}
 
 	go func() {
-		done <- dockerClient.Run(&docker.RunOptions{
+		done <- dockerClient.Run(context.WithoutCancel(ctx), &docker.RunOptions{
 			Image: image,
 			// output to user in case there's an error (e.g. terraform container doesn't have /bin/sleep)
 			OutputStream: &outputBuffer,
@@ -78,6 +87,7 @@ func NewContainer(dockerClient docker.Iface, image, codeDir string, releaseVolum
 	select {
 	case id := <-started:
 		return &Container{
+			ctx:          ctx,
 			dockerClient: dockerClient,
 			id:           id,
 			done:         done,
@@ -394,15 +404,26 @@ func (terraformContainer *Container) CheckFileExists(path string, errorStream io
 	return false, nil
 }
 
+// ReadFile returns the contents of a file inside the terraform container (e.g. /build/release-metadata.json).
+func (terraformContainer *Container) ReadFile(path string, errorStream io.Writer) ([]byte, error) {
+	var outputBuffer bytes.Buffer
+	if err := terraformContainer.RunCommand([]string{"cat", path}, map[string]string{}, &outputBuffer, errorStream); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return outputBuffer.Bytes(), nil
+}
+
 // RunCommand execs a command inside the terraform container.
 func (terraformContainer *Container) RunCommand(cmd []string, env map[string]string, outputStream, errorStream io.Writer) error {
-	return terraformContainer.dockerClient.Exec(&docker.ExecOptions{
-		ID:           terraformContainer.id,
-		Cmd:          cmd,
-		Env:          env,
-		OutputStream: outputStream,
-		ErrorStream:  errorStream,
-		Tty:          false,
+	return terraformContainer.dockerClient.Exec(terraformContainer.ctx, &docker.ExecOptions{
+		ID:               terraformContainer.id,
+		Cmd:              cmd,
+		Env:              env,
+		OutputStream:     outputStream,
+		ErrorStream:      errorStream,
+		Tty:              false,
+		InterruptCmd:     interruptCmd,
+		InterruptTimeout: interruptTimeout,
 	})
 }
 
@@ -415,21 +436,23 @@ func (terraformContainer *Container) RunInteractiveCommand(
 	errorStream io.Writer,
 	tty bool,
 	interactive bool) error {
-	return terraformContainer.dockerClient.Exec(&docker.ExecOptions{
-		ID:           terraformContainer.id,
-		Cmd:          cmd,
-		Env:          env,
-		InputStream:  inputStream,
-		OutputStream: outputStream,
-		ErrorStream:  errorStream,
-		Tty:          tty,
-		Interactive:  interactive,
+	return terraformContainer.dockerClient.Exec(terraformContainer.ctx, &docker.ExecOptions{
+		ID:               terraformContainer.id,
+		Cmd:              cmd,
+		Env:              env,
+		InputStream:      inputStream,
+		OutputStream:     outputStream,
+		ErrorStream:      errorStream,
+		Tty:              tty,
+		Interactive:      interactive,
+		InterruptCmd:     interruptCmd,
+		InterruptTimeout: interruptTimeout,
 	})
 }
 
 // Done stops and removes the terraform container.
 func (terraformContainer *Container) Done() error {
-	if err := terraformContainer.dockerClient.Stop(terraformContainer.id, 10); err != nil {
+	if err := terraformContainer.dockerClient.Stop(context.Background(), terraformContainer.id, 10); err != nil {
 		return err
 	}
 	return <-terraformContainer.done
@@ -2,6 +2,7 @@ package terraform_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"log"
@@ -36,6 +37,7 @@ func TestTerraformInitInitial(t *testing.T) {
 	// When
 	func() {
 		terraformContainer, err := terraform.NewContainer(
+			context.Background(),
 			dockerClient,
 			test.GetConfig("TEST_TERRAFORM_IMAGE"),
 			codeDir,
@@ -122,6 +124,7 @@ func TestTerraformConfigureBackend(t *testing.T) {
 	// When
 	func() {
 		terraformContainer, err := terraform.NewContainer(
+			context.Background(),
 			dockerClient,
 			test.GetConfig("TEST_TERRAFORM_IMAGE"),
 			codeDir,
@@ -204,6 +207,7 @@ func TestSwitchWorkspaceExisting(t *testing.T) {
 	// When
 	func() {
 		terraformContainer, err := terraform.NewContainer(
+			context.Background(),
 			dockerClient,
 			test.GetConfig("TEST_TERRAFORM_IMAGE"),
 			test.GetConfig("TEST_ROOT")+"/test/terraform/sample-code",
@@ -275,6 +279,7 @@ func TestSwitchWorkspaceNew(t *testing.T) {
 	// When
 	func() {
 		terraformContainer, err := terraform.NewContainer(
+			context.Background(),
 			dockerClient,
 			test.GetConfig("TEST_TERRAFORM_IMAGE"),
 			test.GetConfig("TEST_ROOT")+"/test/terraform/sample-code",
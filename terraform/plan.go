@@ -0,0 +1,92 @@
+package terraform
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// GetPlanSummary returns the summary line from the output of terraform plan (e.g. "Plan: 1 to add, 0 to change, 0 to destroy."),
+// or an empty string if there isn't one.
+func GetPlanSummary(planOutput string) string {
+	for _, line := range strings.Split(ansiEscape.ReplaceAllString(planOutput, ""), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Plan:") || strings.HasPrefix(line, "No changes.") {
+			return line
+		}
+	}
+	return ""
+}
+
+var planCount = regexp.MustCompile(`(\d+) to (add|change|destroy)`)
+
+// GetPlanCounts returns the number of resources to add, change and destroy from the output of terraform plan, and
+// false if the output doesn't contain a summary.
+func GetPlanCounts(planOutput string) (add, change, destroy int, ok bool) {
+	summary := GetPlanSummary(planOutput)
+	if summary == "" {
+		return 0, 0, 0, false
+	}
+	for _, match := range planCount.FindAllStringSubmatch(summary, -1) {
+		count, _ := strconv.Atoi(match[1])
+		switch match[2] {
+		case "add":
+			add = count
+		case "change":
+			change = count
+		case "destroy":
+			destroy = count
+		}
+	}
+	return add, change, destroy, true
+}
+
+// ResourceChange is a resource that a plan would change, with the actions that would be taken (e.g. ["update"]).
+type ResourceChange struct {
+	Address string   `json:"address"`
+	Actions []string `json:"actions"`
+}
+
+// GetPlanChanges returns the resources and outputs that would be changed, from the output of terraform show -json PLAN.
+func GetPlanChanges(planJSON []byte) ([]ResourceChange, []string, error) {
+	var plan struct {
+		ResourceChanges []struct {
+			Address string `json:"address"`
+			Change  struct {
+				Actions []string `json:"actions"`
+			} `json:"change"`
+		} `json:"resource_changes"`
+		OutputChanges map[string]struct {
+			Actions []string `json:"actions"`
+		} `json:"output_changes"`
+	}
+	if err := json.Unmarshal(planJSON, &plan); err != nil {
+		return nil, nil, err
+	}
+
+	resourceChanges := []ResourceChange{}
+	for _, resourceChange := range plan.ResourceChanges {
+		if isChange(resourceChange.Change.Actions) {
+			resourceChanges = append(resourceChanges, ResourceChange{resourceChange.Address, resourceChange.Change.Actions})
+		}
+	}
+
+	outputChanges := []string{}
+	for name, outputChange := range plan.OutputChanges {
+		if isChange(outputChange.Actions) {
+			outputChanges = append(outputChanges, name)
+		}
+	}
+	sort.Strings(outputChanges)
+
+	return resourceChanges, outputChanges, nil
+}
+
+// isChange returns false for the actions terraform reports for things that aren't changing (reads are data sources).
+func isChange(actions []string) bool {
+	return !(len(actions) == 1 && (actions[0] == "no-op" || actions[0] == "read"))
+}
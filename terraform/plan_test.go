@@ -0,0 +1,88 @@
+package terraform_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/terraform"
+)
+
+func TestGetPlanSummary(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name:   "changes",
+			output: "Terraform will perform the following actions:\n\n\x1b[1mPlan:\x1b[0m 1 to add, 2 to change, 0 to destroy.\n",
+			want:   "Plan: 1 to add, 2 to change, 0 to destroy.",
+		},
+		{
+			name:   "no changes",
+			output: "\nNo changes. Your infrastructure matches the configuration.\n",
+			want:   "No changes. Your infrastructure matches the configuration.",
+		},
+		{
+			name:   "no summary",
+			output: "message to stdout\n",
+			want:   "",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := terraform.GetPlanSummary(tc.output); got != tc.want {
+				t.Errorf("got %q want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetPlanCounts(t *testing.T) {
+	for _, tc := range []struct {
+		output               string
+		add, change, destroy int
+		ok                   bool
+	}{
+		{"\x1b[1mPlan:\x1b[0m 1 to add, 2 to change, 3 to destroy.\n", 1, 2, 3, true},
+		{"Plan: 1 to import, 4 to add, 0 to change, 0 to destroy.\n", 4, 0, 0, true},
+		{"\nNo changes. Your infrastructure matches the configuration.\n", 0, 0, 0, true},
+		{"message to stdout\n", 0, 0, 0, false},
+	} {
+		add, change, destroy, ok := terraform.GetPlanCounts(tc.output)
+		if add != tc.add || change != tc.change || destroy != tc.destroy || ok != tc.ok {
+			t.Errorf("%q: got %d, %d, %d, %v", tc.output, add, change, destroy, ok)
+		}
+	}
+}
+
+func TestGetPlanChanges(t *testing.T) {
+	planJSON := []byte(`{
+		"format_version": "1.2",
+		"resource_changes": [
+			{"address": "aws_s3_bucket.logs", "change": {"actions": ["update"]}},
+			{"address": "aws_iam_role.task", "change": {"actions": ["no-op"]}},
+			{"address": "data.aws_caller_identity.current", "change": {"actions": ["read"]}},
+			{"address": "aws_ecs_service.app", "change": {"actions": ["delete", "create"]}}
+		],
+		"output_changes": {
+			"url": {"actions": ["update"]},
+			"arn": {"actions": ["no-op"]}
+		}
+	}`)
+
+	resourceChanges, outputChanges, err := terraform.GetPlanChanges(planJSON)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	wantResourceChanges := []terraform.ResourceChange{
+		{Address: "aws_s3_bucket.logs", Actions: []string{"update"}},
+		{Address: "aws_ecs_service.app", Actions: []string{"delete", "create"}},
+	}
+	if !reflect.DeepEqual(resourceChanges, wantResourceChanges) {
+		t.Errorf("got %+v want %+v", resourceChanges, wantResourceChanges)
+	}
+	if !reflect.DeepEqual(outputChanges, []string{"url"}) {
+		t.Errorf("got %v want [url]", outputChanges)
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -19,7 +21,7 @@ type Message struct {
 
 func main() {
 	if len(os.Args) == 2 && os.Args[1] == "forward" {
-		common.Forward(os.Stdin, os.Stdout, "")
+		forward()
 	} else {
 		common.Listen(NewHandler(), "", "/release", nil)
 	}
@@ -157,3 +159,283 @@ func (*handler) PrepareTerraform(request *common.PrepareTerraformRequest, respon
 
 	return nil
 }
+
+// forward answers the actions that the config common library doesn't dispatch itself, and forwards the rest to the
+// server. State is kept in files so that later requests to the same container see it.
+func forward() {
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		log.Panicln("error reading request:", err)
+	}
+	var message Message
+	if err := json.Unmarshal(data, &message); err != nil {
+		log.Panicln("error decoding request:", err)
+	}
+	var response interface{}
+	switch message.Action {
+	case "list_deployments":
+		response = listDeployments(data)
+	case "record_deployment":
+		response = recordDeployment(data)
+	case "list_releases":
+		response = listReleases(data)
+	case "get_release":
+		response = getRelease(data)
+	case "read_release_file":
+		response = readReleaseFile(data)
+	case "lock_environment":
+		response = lockEnvironment(data)
+	case "unlock_environment":
+		response = unlockEnvironment(data)
+	case "get_environment_lock":
+		response = getEnvironmentLock(data)
+	default:
+		common.Forward(bytes.NewReader(data), os.Stdout, "")
+		return
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(response); err != nil {
+		log.Panicln("error encoding response:", err)
+	}
+}
+
+func decodeRequest(data []byte, request interface{}) {
+	if err := json.Unmarshal(data, request); err != nil {
+		log.Panicln("error decoding request:", err)
+	}
+}
+
+// readState reads json from filename into data, leaving data alone if the file doesn't exist yet.
+func readState(filename string, data interface{}) {
+	content, err := ioutil.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	} else if err != nil {
+		log.Panicf("could not read %s: %s", filename, err)
+	}
+	if err := json.Unmarshal(content, data); err != nil {
+		log.Panicf("could not decode %s: %s", filename, err)
+	}
+}
+
+func writeState(filename string, data interface{}) {
+	content, err := json.Marshal(data)
+	if err != nil {
+		log.Panicf("error serialising %v as json: %v", data, err)
+	}
+	if err := ioutil.WriteFile(filename, content, 0644); err != nil {
+		log.Panicf("could not write to %s: %s", filename, err)
+	}
+}
+
+const deploymentsFilename = "/tmp/deployments.json"
+
+// Deployment is an entry in the deployment history.
+type Deployment struct {
+	Version string
+	Commit  string
+	Time    string
+	Outcome string
+}
+
+// EnvironmentRequest is a request relating to a single environment.
+type EnvironmentRequest struct {
+	Component string
+	EnvName   string
+}
+
+func listDeployments(data []byte) interface{} {
+	var request EnvironmentRequest
+	decodeRequest(data, &request)
+	writeDebug(map[string]interface{}{
+		"Action":  "list_deployments",
+		"Request": &request,
+	}, "/debug/list-deployments.json")
+
+	deployments := []*Deployment{}
+	readState(deploymentsFilename, &deployments)
+	return map[string]interface{}{
+		"Deployments": deployments,
+		"Success":     true,
+	}
+}
+
+// RecordDeploymentRequest is a request to record the outcome of a deployment.
+type RecordDeploymentRequest struct {
+	Version     string
+	Component   string
+	Commit      string
+	EnvName     string
+	PlanSummary string
+	Outcome     string
+	Error       string
+}
+
+func recordDeployment(data []byte) interface{} {
+	var request RecordDeploymentRequest
+	decodeRequest(data, &request)
+	writeDebug(map[string]interface{}{
+		"Action":  "record_deployment",
+		"Request": &request,
+	}, "/debug/record-deployment.json")
+
+	var deployments []*Deployment
+	readState(deploymentsFilename, &deployments)
+	deployments = append([]*Deployment{{
+		Version: request.Version,
+		Commit:  request.Commit,
+		Time:    "2020-01-01T00:00:00Z",
+		Outcome: request.Outcome,
+	}}, deployments...)
+	writeState(deploymentsFilename, deployments)
+
+	return map[string]interface{}{"Success": true}
+}
+
+// Release is a stored release.
+type Release struct {
+	Version  string
+	Commit   string
+	Created  string
+	Metadata map[string]map[string]string
+}
+
+func testRelease(version string) *Release {
+	return &Release{
+		Version: version,
+		Commit:  "commit-for-" + version,
+		Created: "2020-01-01T00:00:00Z",
+		Metadata: map[string]map[string]string{
+			"release": {"version": version},
+		},
+	}
+}
+
+// ComponentRequest is a request relating to the component as a whole.
+type ComponentRequest struct {
+	Component string
+}
+
+func listReleases(data []byte) interface{} {
+	var request ComponentRequest
+	decodeRequest(data, &request)
+	writeDebug(map[string]interface{}{
+		"Action":  "list_releases",
+		"Request": &request,
+	}, "/debug/list-releases.json")
+
+	return map[string]interface{}{
+		"Releases": []*Release{testRelease("2"), testRelease("1")},
+		"Success":  true,
+	}
+}
+
+// GetReleaseRequest is a request for a single release.
+type GetReleaseRequest struct {
+	Version   string
+	Component string
+}
+
+func getRelease(data []byte) interface{} {
+	var request GetReleaseRequest
+	decodeRequest(data, &request)
+	writeDebug(map[string]interface{}{
+		"Action":  "get_release",
+		"Request": &request,
+	}, "/debug/get-release.json")
+
+	return map[string]interface{}{
+		"Release": testRelease(request.Version),
+		"Success": true,
+	}
+}
+
+// ReadReleaseFileRequest is a request for a file saved in a release.
+type ReadReleaseFileRequest struct {
+	Version   string
+	Component string
+	Filename  string
+}
+
+func readReleaseFile(data []byte) interface{} {
+	var request ReadReleaseFileRequest
+	decodeRequest(data, &request)
+	writeDebug(map[string]interface{}{
+		"Action":  "read_release_file",
+		"Request": &request,
+	}, "/debug/read-release-file.json")
+
+	if request.Filename != "terraform-image" {
+		return map[string]interface{}{
+			"Found":   false,
+			"Success": true,
+		}
+	}
+	return map[string]interface{}{
+		"Content": []byte("terraform-image-for-" + request.Version),
+		"Found":   true,
+		"Success": true,
+	}
+}
+
+const lockFilename = "/tmp/lock.json"
+
+// Lock describes who locked an environment and why.
+type Lock struct {
+	LockedBy string
+	Reason   string
+	Time     string
+}
+
+// LockEnvironmentRequest is a request to lock an environment.
+type LockEnvironmentRequest struct {
+	Component string
+	EnvName   string
+	LockedBy  string
+	Reason    string
+}
+
+func lockEnvironment(data []byte) interface{} {
+	var request LockEnvironmentRequest
+	decodeRequest(data, &request)
+	writeDebug(map[string]interface{}{
+		"Action":  "lock_environment",
+		"Request": &request,
+	}, "/debug/lock-environment.json")
+
+	writeState(lockFilename, &Lock{
+		LockedBy: request.LockedBy,
+		Reason:   request.Reason,
+		Time:     "2020-01-01T00:00:00Z",
+	})
+	return map[string]interface{}{"Success": true}
+}
+
+func unlockEnvironment(data []byte) interface{} {
+	var request EnvironmentRequest
+	decodeRequest(data, &request)
+	writeDebug(map[string]interface{}{
+		"Action":  "unlock_environment",
+		"Request": &request,
+	}, "/debug/unlock-environment.json")
+
+	if err := os.Remove(lockFilename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Panicf("could not remove %s: %s", lockFilename, err)
+	}
+	return map[string]interface{}{"Success": true}
+}
+
+func getEnvironmentLock(data []byte) interface{} {
+	var request EnvironmentRequest
+	decodeRequest(data, &request)
+	writeDebug(map[string]interface{}{
+		"Action":  "get_environment_lock",
+		"Request": &request,
+	}, "/debug/get-environment-lock.json")
+
+	var lock *Lock
+	readState(lockFilename, &lock)
+	return map[string]interface{}{
+		"Lock":    lock,
+		"Success": true,
+	}
+}
@@ -0,0 +1,230 @@
+package trivy
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const CONFIG_ERROR_ON_FINDINGS = "errorOnFindings"
+const CONFIG_SBOM = "sbom"
+const CONFIG_SBOM_FORMAT = "sbomFormat"
+const CONFIG_SEVERITY = "severity"
+const CONFIG_FAIL_SEVERITY = "failSeverity"
+const CONFIG_REPOSITORY_SCANNERS = "repositoryScanners"
+const CONFIG_IMAGE_SCANNERS = "imageScanners"
+const CONFIG_IGNORE_UNFIXED = "ignoreUnfixed"
+const CONFIG_IGNORE_FILE = "ignoreFile"
+const CONFIG_SKIP_DIRS = "skipDirs"
+const CONFIG_INFRA_SCAN = "infraScan"
+const CONFIG_INFRA_SCAN_ON_DEPLOY = "infraScanOnDeploy"
+
+// Severities are the trivy severities, from lowest to highest.
+var Severities = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// Scanners are the trivy scanners that can be configured.
+var Scanners = []string{"vuln", "misconfig", "secret", "license"}
+
+// sbomExtensions are the file extensions for the supported SBOM formats.
+var sbomExtensions = map[string]string{
+	"cyclonedx": ".cdx.json",
+	"spdx-json": ".spdx.json",
+	"spdx":      ".spdx",
+}
+
+// Config is the scanning policy from the trivy params in cdflow.yaml.
+type Config struct {
+	errorOnFindings    bool
+	sbom               bool
+	sbomFormat         string
+	severity           string
+	failSeverity       string
+	repositoryScanners []string
+	imageScanners      []string
+	ignoreUnfixed      bool
+	ignoreFile         string
+	skipDirs           []string
+	infraScan          bool
+	infraScanOnDeploy  bool
+}
+
+// SBOM returns true if a software bill of materials should be generated for the repository and each image released.
+func (config Config) SBOM() bool {
+	return config.sbom
+}
+
+// SBOMFormat returns the trivy format of the software bill of materials (e.g. cyclonedx).
+func (config Config) SBOMFormat() string {
+	return config.sbomFormat
+}
+
+// InfraScan returns true if the terraform code in infra/ should be scanned for misconfigurations during release.
+func (config Config) InfraScan() bool {
+	return config.infraScan
+}
+
+// InfraScanOnDeploy returns true if the terraform code in infra/ should be scanned for misconfigurations, with the var
+// files for the environment, before each deploy.
+func (config Config) InfraScanOnDeploy() bool {
+	return config.infraScanOnDeploy
+}
+
+// Severity returns the lowest severity of the findings that are reported.
+func (config Config) Severity() string {
+	return config.severity
+}
+
+// FailSeverity returns the lowest severity of the findings that count against the release (failing it if
+// errorOnFindings is set).
+func (config Config) FailSeverity() string {
+	return config.failSeverity
+}
+
+// severities returns the severities from the lowest given up, as a trivy --severity value.
+func severities(lowest string) string {
+	return strings.Join(Severities[slices.Index(Severities, lowest):], ",")
+}
+
+func GetConfig(params map[string]interface{}) (Config, error) {
+	config := Config{
+		errorOnFindings:    false, // default value
+		sbom:               false, // opt in, as it adds containers and files to each release
+		sbomFormat:         "cyclonedx",
+		severity:           "CRITICAL",
+		repositoryScanners: []string{"vuln", "secret"},
+		imageScanners:      []string{"vuln", "misconfig", "secret"},
+		ignoreUnfixed:      true,
+	}
+	var err error
+	if config.errorOnFindings, err = getBool(params, CONFIG_ERROR_ON_FINDINGS, config.errorOnFindings); err != nil {
+		return config, err
+	}
+	if config.sbom, err = getBool(params, CONFIG_SBOM, config.sbom); err != nil {
+		return config, err
+	}
+	if config.sbomFormat, err = getString(params, CONFIG_SBOM_FORMAT, config.sbomFormat); err != nil {
+		return config, err
+	}
+	if _, ok := sbomExtensions[config.sbomFormat]; !ok {
+		return config, fmt.Errorf("%s must be cyclonedx, spdx-json or spdx, got %v", CONFIG_SBOM_FORMAT, config.sbomFormat)
+	}
+
+	if config.severity, err = getSeverity(params, CONFIG_SEVERITY, config.severity); err != nil {
+		return config, err
+	}
+	// by default the findings that are reported are also those that count
+	if config.failSeverity, err = getSeverity(params, CONFIG_FAIL_SEVERITY, config.severity); err != nil {
+		return config, err
+	}
+	if slices.Index(Severities, config.failSeverity) < slices.Index(Severities, config.severity) {
+		return config, fmt.Errorf("%s (%s) must not be lower than %s (%s), since findings that fail the release must be reported", CONFIG_FAIL_SEVERITY, config.failSeverity, CONFIG_SEVERITY, config.severity)
+	}
+
+	if config.repositoryScanners, err = getScanners(params, CONFIG_REPOSITORY_SCANNERS, config.repositoryScanners); err != nil {
+		return config, err
+	}
+	if config.imageScanners, err = getScanners(params, CONFIG_IMAGE_SCANNERS, config.imageScanners); err != nil {
+		return config, err
+	}
+	if config.ignoreUnfixed, err = getBool(params, CONFIG_IGNORE_UNFIXED, config.ignoreUnfixed); err != nil {
+		return config, err
+	}
+	if config.ignoreFile, err = getString(params, CONFIG_IGNORE_FILE, config.ignoreFile); err != nil {
+		return config, err
+	}
+	if config.ignoreFile != "" && !filepath.IsLocal(config.ignoreFile) {
+		return config, fmt.Errorf("%s must be a path within the repository, got %s", CONFIG_IGNORE_FILE, config.ignoreFile)
+	}
+	if config.skipDirs, err = getList(params, CONFIG_SKIP_DIRS, config.skipDirs); err != nil {
+		return config, err
+	}
+	for _, dir := range config.skipDirs {
+		if !filepath.IsLocal(dir) {
+			return config, fmt.Errorf("%s must be paths within the repository, got %s", CONFIG_SKIP_DIRS, dir)
+		}
+	}
+	if config.infraScan, err = getBool(params, CONFIG_INFRA_SCAN, config.infraScan); err != nil {
+		return config, err
+	}
+	if config.infraScanOnDeploy, err = getBool(params, CONFIG_INFRA_SCAN_ON_DEPLOY, config.infraScanOnDeploy); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+func getBool(params map[string]interface{}, key string, defaultValue bool) (bool, error) {
+	val, ok := params[key]
+	if !ok {
+		return defaultValue, nil
+	}
+	result, ok := val.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s must be true or false, got %v", key, val)
+	}
+	return result, nil
+}
+
+func getString(params map[string]interface{}, key, defaultValue string) (string, error) {
+	val, ok := params[key]
+	if !ok {
+		return defaultValue, nil
+	}
+	result, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string, got %v", key, val)
+	}
+	return result, nil
+}
+
+// getList gets a list, which can be given as a YAML list or a comma separated string.
+func getList(params map[string]interface{}, key string, defaultValue []string) ([]string, error) {
+	val, ok := params[key]
+	if !ok {
+		return defaultValue, nil
+	}
+	if str, ok := val.(string); ok {
+		return strings.Split(str, ","), nil
+	}
+	items, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be a list, got %v", key, val)
+	}
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		str, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a list of strings, got %v", key, item)
+		}
+		result = append(result, str)
+	}
+	return result, nil
+}
+
+func getSeverity(params map[string]interface{}, key, defaultValue string) (string, error) {
+	severity, err := getString(params, key, defaultValue)
+	if err != nil {
+		return "", err
+	}
+	severity = strings.ToUpper(severity)
+	if !slices.Contains(Severities, severity) {
+		return "", fmt.Errorf("%s must be one of %s, got %s", key, strings.Join(Severities, ", "), severity)
+	}
+	return severity, nil
+}
+
+func getScanners(params map[string]interface{}, key string, defaultValue []string) ([]string, error) {
+	scanners, err := getList(params, key, defaultValue)
+	if err != nil {
+		return nil, err
+	}
+	if len(scanners) == 0 {
+		return nil, fmt.Errorf("%s must not be empty", key)
+	}
+	for _, scanner := range scanners {
+		if !slices.Contains(Scanners, scanner) {
+			return nil, fmt.Errorf("%s must be from %s, got %s", key, strings.Join(Scanners, ", "), scanner)
+		}
+	}
+	return scanners, nil
+}
@@ -2,18 +2,18 @@ package trivy
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"path"
 	"strconv"
+	"strings"
 
 	"github.com/mergermarket/cdflow2/docker"
 )
 
-type Config struct {
-	errorOnFindings bool
-}
-
 type Container struct {
+	ctx          context.Context
 	dockerClient docker.Iface
 	id           string
 	done         chan error
@@ -22,10 +22,11 @@ type Container struct {
 }
 
 const CODE_DIR = "/code"
-const CRITICAL_FINDINGS_EXIT_CODE = "5"
-const CONFIG_ERROR_ON_FINDINGS = "errorOnFindings"
 
-func NewContainer(dockerClient docker.Iface,
+// INFRA_DIR is the directory in the repository with the terraform code.
+const INFRA_DIR = "infra"
+
+func NewContainer(ctx context.Context, dockerClient docker.Iface,
 	image,
 	codeDir string,
 	params map[string]interface{}) (*Container, error) {
@@ -42,7 +43,7 @@ func NewContainer(dockerClient docker.Iface,
 	var outputBuffer bytes.Buffer
 
 	go func() {
-		done <- dockerClient.Run(
+		done <- dockerClient.Run(context.WithoutCancel(ctx),
 			&docker.RunOptions{
 				Image:        image,
 				OutputStream: &outputBuffer,
@@ -64,6 +65,7 @@ func NewContainer(dockerClient docker.Iface,
 	select {
 	case id := <-started:
 		return &Container{
+			ctx:          ctx,
 			dockerClient: dockerClient,
 			id:           id,
 			done:         done,
@@ -80,74 +82,115 @@ func (trivyContainer *Container) ErrorOnFindings() bool {
 	return trivyContainer.config.errorOnFindings
 }
 
-func (trivyContainer *Container) ScanRepository(outputStream, errorStream io.Writer) (bool, error) {
-	cmd := []string{
-		"trivy",
-		"fs",
-		"--severity", "CRITICAL",
-		"--ignore-unfixed",
-		"--scanners", "vuln,secret",
-		"--exit-code", CRITICAL_FINDINGS_EXIT_CODE,
-		CODE_DIR,
+// ScanRepository scans the repository, printing trivy's progress and returning a summary of the findings.
+func (trivyContainer *Container) ScanRepository(errorStream io.Writer) (*Findings, error) {
+	var options []string
+	if trivyContainer.config.ignoreFile != "" {
+		options = append(options, "--ignorefile", path.Join(CODE_DIR, trivyContainer.config.ignoreFile))
 	}
-	return trivyContainer.hadleError(trivyContainer.dockerClient.Exec(
-		&docker.ExecOptions{
-			ID:           trivyContainer.id,
-			Cmd:          cmd,
-			OutputStream: outputStream,
-			ErrorStream:  errorStream,
-			Tty:          false,
-		}))
+	for _, dir := range trivyContainer.config.skipDirs {
+		options = append(options, "--skip-dirs", path.Join(CODE_DIR, dir))
+	}
+	return trivyContainer.scan("fs", trivyContainer.config.repositoryScanners, options, CODE_DIR, errorStream)
+}
+
+// ScanImage scans an image, printing trivy's progress and returning a summary of the findings.
+func (trivyContainer *Container) ScanImage(image string, errorStream io.Writer) (*Findings, error) {
+	var options []string
+	if trivyContainer.config.ignoreFile != "" {
+		options = append(options, "--ignorefile", path.Join(CODE_DIR, trivyContainer.config.ignoreFile))
+	}
+	return trivyContainer.scan("image", trivyContainer.config.imageScanners, options, image, errorStream)
+}
+
+// ScanInfra scans the terraform code for misconfigurations, with the var files given (paths within the repository),
+// printing trivy's progress and returning a summary of the findings.
+func (trivyContainer *Container) ScanInfra(varFiles []string, errorStream io.Writer) (*Findings, error) {
+	var options []string
+	if trivyContainer.config.ignoreFile != "" {
+		options = append(options, "--ignorefile", path.Join(CODE_DIR, trivyContainer.config.ignoreFile))
+	}
+	for _, varFile := range varFiles {
+		options = append(options, "--tf-vars", path.Join(CODE_DIR, varFile))
+	}
+	return trivyContainer.scan("config", nil, options, path.Join(CODE_DIR, INFRA_DIR), errorStream)
 }
 
-func (trivyContainer *Container) ScanImage(image string, outputStream, errorStream io.Writer) (bool, error) {
-	cmd := []string{
-		"trivy",
-		"image",
-		"--severity", "CRITICAL",
-		"--ignore-unfixed",
-		"--scanners", "vuln,misconfig,secret",
-		"--exit-code", CRITICAL_FINDINGS_EXIT_CODE,
-		image,
+// scan gets the findings from the severity up as JSON, with those from the fail severity up counting against the
+// release (an error if errorOnFindings is set).
+func (trivyContainer *Container) scan(target string, scanners, options []string, name string, errorStream io.Writer) (*Findings, error) {
+	config := trivyContainer.config
+	cmd := []string{"trivy", target, "--severity", severities(config.severity)}
+	// trivy config only looks for misconfigurations, so doesn't take scanners
+	if scanners != nil {
+		if config.ignoreUnfixed {
+			cmd = append(cmd, "--ignore-unfixed")
+		}
+		cmd = append(cmd, "--scanners", strings.Join(scanners, ","))
+	}
+	cmd = append(cmd, "--format", "json")
+	cmd = append(cmd, options...)
+	cmd = append(cmd, name)
+
+	var outputBuffer bytes.Buffer
+	if err := trivyContainer.exec(cmd, &outputBuffer, errorStream); err != nil {
+		return nil, fmt.Errorf("error executing trivy command: %w", err)
+	}
+	findings, err := ParseFindings(outputBuffer.Bytes(), config.failSeverity)
+	if err != nil {
+		return nil, err
+	}
+	if findings.Fail && trivyContainer.ErrorOnFindings() {
+		return findings, fmt.Errorf("trivy scan found issues of severity %s or above", config.failSeverity)
 	}
-	return trivyContainer.hadleError(trivyContainer.dockerClient.Exec(
+	return findings, nil
+}
+
+func (trivyContainer *Container) exec(cmd []string, outputStream, errorStream io.Writer) error {
+	return trivyContainer.dockerClient.Exec(trivyContainer.ctx,
 		&docker.ExecOptions{
 			ID:           trivyContainer.id,
 			Cmd:          cmd,
 			OutputStream: outputStream,
 			ErrorStream:  errorStream,
 			Tty:          false,
-		}))
+		})
 }
 
-func (trivyContainer *Container) Done() error {
-	if err := trivyContainer.dockerClient.Stop(trivyContainer.id, 10); err != nil {
-		return err
-	}
-	return <-trivyContainer.done
+// Config returns the configuration from the trivy params in cdflow.yaml.
+func (trivyContainer *Container) Config() Config {
+	return trivyContainer.config
 }
 
-func GetConfig(params map[string]interface{}) (Config, error) {
-	config := Config{
-		errorOnFindings: false, // default value
-	}
-	if val, ok := params[CONFIG_ERROR_ON_FINDINGS]; ok {
-		if errorOnFindings, ok := val.(bool); ok {
-			config.errorOnFindings = errorOnFindings
-		}
+// RepositorySBOM returns a software bill of materials for the repository.
+func (trivyContainer *Container) RepositorySBOM(errorStream io.Writer) ([]byte, error) {
+	return trivyContainer.sbom("fs", CODE_DIR, errorStream)
+}
+
+// ImageSBOM returns a software bill of materials for an image.
+func (trivyContainer *Container) ImageSBOM(image string, errorStream io.Writer) ([]byte, error) {
+	return trivyContainer.sbom("image", image, errorStream)
+}
+
+// SBOMFilename returns the filename for a software bill of materials, with the extension for the format.
+func (trivyContainer *Container) SBOMFilename(name string) string {
+	return name + sbomExtensions[trivyContainer.config.sbomFormat]
+}
+
+func (trivyContainer *Container) sbom(target, name string, errorStream io.Writer) ([]byte, error) {
+	var outputBuffer bytes.Buffer
+	if err := trivyContainer.exec(
+		[]string{"trivy", target, "--format", trivyContainer.config.sbomFormat, name},
+		&outputBuffer, errorStream,
+	); err != nil {
+		return nil, fmt.Errorf("error generating SBOM with trivy: %w", err)
 	}
-	return config, nil
+	return outputBuffer.Bytes(), nil
 }
 
-func (trivyContainer *Container) hadleError(err error) (bool, error) {
-	if err != nil {
-		if err.Error() == "exec process exited with error status code "+CRITICAL_FINDINGS_EXIT_CODE {
-			if trivyContainer.ErrorOnFindings() {
-				return true, fmt.Errorf("trivy scan found critical issues")
-			}
-			return true, nil
-		}
-		return false, fmt.Errorf("error executing trivy command: %w", err)
+func (trivyContainer *Container) Done() error {
+	if err := trivyContainer.dockerClient.Stop(context.Background(), trivyContainer.id, 10); err != nil {
+		return err
 	}
-	return false, nil
+	return <-trivyContainer.done
 }
@@ -2,6 +2,8 @@ package trivy_test
 
 import (
 	"bytes"
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/mergermarket/cdflow2/test"
@@ -24,6 +26,7 @@ func TestNewTrivyContainer(t *testing.T) {
 	func() { // Ensure the code directory exists
 		// When
 		trivyContainer, err := trivy.NewContainer(
+			context.Background(),
 			dockerClient,
 			test.GetConfig("TEST_TRIVY_IMAGE"),
 			codeDir,
@@ -41,8 +44,8 @@ func TestNewTrivyContainer(t *testing.T) {
 }
 
 func TestTrivyLocalScan(t *testing.T) {
-	outputBuffer := &bytes.Buffer{}
 	errorBuffer := &bytes.Buffer{}
+	var findings *trivy.Findings
 
 	// Given
 	dockerClient, debugVolume := test.GetDockerClientWithDebugVolume()
@@ -58,6 +61,7 @@ func TestTrivyLocalScan(t *testing.T) {
 	func() { // Ensure the code directory exists
 		// When
 		trivyContainer, err := trivy.NewContainer(
+			context.Background(),
 			dockerClient,
 			test.GetConfig("TEST_TRIVY_IMAGE"),
 			codeDir,
@@ -71,8 +75,7 @@ func TestTrivyLocalScan(t *testing.T) {
 				t.Fatal("error cleaning up trivy container:", err)
 			}
 		}()
-		if _, err := trivyContainer.ScanRepository(
-			outputBuffer,
+		if findings, err = trivyContainer.ScanRepository(
 			errorBuffer,
 		); err != nil {
 			t.Fatalf("unexpected error during local scan: %v", err)
@@ -80,17 +83,17 @@ func TestTrivyLocalScan(t *testing.T) {
 	}()
 
 	// Then
-	if errorBuffer.String() != "" {
-		t.Errorf("expected no error output, got: %s", errorBuffer.String())
+	expectedString := "[trivy fs --severity CRITICAL --ignore-unfixed --scanners vuln,secret --format json /code]"
+	if !bytes.Contains(errorBuffer.Bytes(), []byte(expectedString)) {
+		t.Errorf("expected output to contain %s, got: %s", expectedString, errorBuffer.String())
 	}
-	expectedString := "[trivy fs --severity CRITICAL --ignore-unfixed --scanners vuln,secret --exit-code 5 /code]"
-	if !bytes.Contains(outputBuffer.Bytes(), []byte(expectedString)) {
-		t.Errorf("expected output to contain %s, got: %s", expectedString, outputBuffer.String())
+	// the test image returns a high severity vulnerability
+	if findings.Counts["HIGH"] != 1 || findings.Fail {
+		t.Errorf("unexpected findings: %+v", findings)
 	}
 }
 
 func TestTrivyImageScan(t *testing.T) {
-	outputBuffer := &bytes.Buffer{}
 	errorBuffer := &bytes.Buffer{}
 
 	// Given
@@ -108,6 +111,7 @@ func TestTrivyImageScan(t *testing.T) {
 	func() {
 		// When
 		trivyContainer, err := trivy.NewContainer(
+			context.Background(),
 			dockerClient,
 			test.GetConfig("TEST_TRIVY_IMAGE"),
 			codeDir,
@@ -123,7 +127,6 @@ func TestTrivyImageScan(t *testing.T) {
 		}()
 		if _, err := trivyContainer.ScanImage(
 			"test-image:latest", // Replace with an actual image if needed
-			outputBuffer,
 			errorBuffer,
 		); err != nil {
 			t.Fatalf("unexpected error during local scan: %v", err)
@@ -131,12 +134,200 @@ func TestTrivyImageScan(t *testing.T) {
 	}()
 
 	// Then
-	if errorBuffer.String() != "" {
-		t.Errorf("expected no error output, got: %s", errorBuffer.String())
+	expectedString := "[trivy image --severity CRITICAL --ignore-unfixed --scanners vuln,misconfig,secret --format json test-image:latest]"
+	if !bytes.Contains(errorBuffer.Bytes(), []byte(expectedString)) {
+		t.Errorf("expected output to contain %s, got: %s", expectedString, errorBuffer.String())
 	}
-	expectedString := "[trivy image --severity CRITICAL --ignore-unfixed --scanners vuln,misconfig,secret --exit-code 5 test-image:latest]"
-	if !bytes.Contains(outputBuffer.Bytes(), []byte(expectedString)) {
-		t.Errorf("expected output to contain %s, got: %s", expectedString, outputBuffer.String())
+
+}
+
+func TestGetConfig(t *testing.T) {
+	config, err := trivy.GetConfig(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.SBOM() || config.SBOMFormat() != "cyclonedx" {
+		t.Errorf("unexpected defaults: sbom %v, format %s", config.SBOM(), config.SBOMFormat())
 	}
 
+	config, err = trivy.GetConfig(map[string]interface{}{
+		trivy.CONFIG_SBOM:        true,
+		trivy.CONFIG_SBOM_FORMAT: "spdx-json",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !config.SBOM() || config.SBOMFormat() != "spdx-json" {
+		t.Errorf("unexpected config: sbom %v, format %s", config.SBOM(), config.SBOMFormat())
+	}
+
+	config, err = trivy.GetConfig(map[string]interface{}{
+		trivy.CONFIG_SEVERITY:      "high",
+		trivy.CONFIG_FAIL_SEVERITY: "CRITICAL",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Severity() != "HIGH" || config.FailSeverity() != "CRITICAL" {
+		t.Errorf("unexpected config: severity %s, fail severity %s", config.Severity(), config.FailSeverity())
+	}
+
+	config, err = trivy.GetConfig(map[string]interface{}{
+		trivy.CONFIG_INFRA_SCAN_ON_DEPLOY: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.InfraScan() || !config.InfraScanOnDeploy() {
+		t.Errorf("unexpected config: infra scan %v, on deploy %v", config.InfraScan(), config.InfraScanOnDeploy())
+	}
+
+	for _, params := range []map[string]interface{}{
+		{trivy.CONFIG_ERROR_ON_FINDINGS: "true"},
+		{trivy.CONFIG_SBOM: "yes"},
+		{trivy.CONFIG_SBOM_FORMAT: "xml"},
+		{trivy.CONFIG_SBOM_FORMAT: 1},
+		{trivy.CONFIG_SEVERITY: "SEVERE"},
+		{trivy.CONFIG_SEVERITY: "CRITICAL", trivy.CONFIG_FAIL_SEVERITY: "HIGH"},
+		{trivy.CONFIG_REPOSITORY_SCANNERS: []interface{}{"vuln", "viruses"}},
+		{trivy.CONFIG_IMAGE_SCANNERS: []interface{}{}},
+		{trivy.CONFIG_IGNORE_UNFIXED: "no"},
+		{trivy.CONFIG_IGNORE_FILE: "../.trivyignore"},
+		{trivy.CONFIG_SKIP_DIRS: []interface{}{"/etc"}},
+		{trivy.CONFIG_INFRA_SCAN: "yes"},
+	} {
+		if _, err := trivy.GetConfig(params); err == nil {
+			t.Errorf("expected error for %v", params)
+		}
+	}
+}
+
+func TestTrivyImageSBOM(t *testing.T) {
+	errorBuffer := &bytes.Buffer{}
+
+	// Given
+	dockerClient, debugVolume := test.GetDockerClientWithDebugVolume()
+	defer test.RemoveVolume(dockerClient, debugVolume)
+
+	codeDir := test.GetConfig("TEST_ROOT") + "/test/trivy/sample-code"
+
+	var sbom []byte
+	func() {
+		// When
+		trivyContainer, err := trivy.NewContainer(
+			context.Background(),
+			dockerClient,
+			test.GetConfig("TEST_TRIVY_IMAGE"),
+			codeDir,
+			map[string]interface{}{},
+		)
+		if err != nil {
+			t.Fatal("error creating trivy container:", err)
+		}
+		defer func() {
+			if err := trivyContainer.Done(); err != nil {
+				t.Fatal("error cleaning up trivy container:", err)
+			}
+		}()
+		if sbom, err = trivyContainer.ImageSBOM("test-image:latest", errorBuffer); err != nil {
+			t.Fatalf("unexpected error generating SBOM: %v", err)
+		}
+		if filename := trivyContainer.SBOMFilename("build"); filename != "build.cdx.json" {
+			t.Errorf("unexpected SBOM filename: %s", filename)
+		}
+	}()
+
+	// Then
+	expectedString := "[trivy image --format cyclonedx test-image:latest]"
+	if !strings.Contains(string(sbom), expectedString) {
+		t.Errorf("expected SBOM to contain %s, got: %s", expectedString, string(sbom))
+	}
+}
+
+func TestTrivyScanPolicy(t *testing.T) {
+	errorBuffer := &bytes.Buffer{}
+
+	// Given
+	dockerClient, debugVolume := test.GetDockerClientWithDebugVolume()
+	defer test.RemoveVolume(dockerClient, debugVolume)
+
+	codeDir := test.GetConfig("TEST_ROOT") + "/test/trivy/sample-code"
+	params := map[string]interface{}{
+		trivy.CONFIG_SEVERITY:            "HIGH",
+		trivy.CONFIG_FAIL_SEVERITY:       "CRITICAL",
+		trivy.CONFIG_REPOSITORY_SCANNERS: []interface{}{"vuln", "misconfig"},
+		trivy.CONFIG_IGNORE_UNFIXED:      false,
+		trivy.CONFIG_IGNORE_FILE:         "security/.trivyignore",
+		trivy.CONFIG_SKIP_DIRS:           "node_modules,vendor",
+	}
+
+	func() {
+		// When
+		trivyContainer, err := trivy.NewContainer(
+			context.Background(),
+			dockerClient,
+			test.GetConfig("TEST_TRIVY_IMAGE"),
+			codeDir,
+			params,
+		)
+		if err != nil {
+			t.Fatal("error creating trivy container:", err)
+		}
+		defer func() {
+			if err := trivyContainer.Done(); err != nil {
+				t.Fatal("error cleaning up trivy container:", err)
+			}
+		}()
+		if _, err := trivyContainer.ScanRepository(errorBuffer); err != nil {
+			t.Fatalf("unexpected error during local scan: %v", err)
+		}
+	}()
+
+	// Then
+	expectedString := "[trivy fs --severity HIGH,CRITICAL --scanners vuln,misconfig --format json --ignorefile /code/security/.trivyignore --skip-dirs /code/node_modules --skip-dirs /code/vendor /code]"
+	if strings.TrimSpace(errorBuffer.String()) != expectedString {
+		t.Errorf("expected output %s, got: %s", expectedString, errorBuffer.String())
+	}
+}
+
+func TestTrivyInfraScan(t *testing.T) {
+	errorBuffer := &bytes.Buffer{}
+
+	// Given
+	dockerClient, debugVolume := test.GetDockerClientWithDebugVolume()
+	defer test.RemoveVolume(dockerClient, debugVolume)
+
+	codeDir := test.GetConfig("TEST_ROOT") + "/test/trivy/sample-code"
+	params := map[string]interface{}{
+		trivy.CONFIG_SEVERITY:    "HIGH",
+		trivy.CONFIG_IGNORE_FILE: ".trivyignore",
+	}
+
+	func() {
+		// When
+		trivyContainer, err := trivy.NewContainer(
+			context.Background(),
+			dockerClient,
+			test.GetConfig("TEST_TRIVY_IMAGE"),
+			codeDir,
+			params,
+		)
+		if err != nil {
+			t.Fatal("error creating trivy container:", err)
+		}
+		defer func() {
+			if err := trivyContainer.Done(); err != nil {
+				t.Fatal("error cleaning up trivy container:", err)
+			}
+		}()
+		if _, err := trivyContainer.ScanInfra([]string{"config/common.json", "config/live.json"}, errorBuffer); err != nil {
+			t.Fatalf("unexpected error during infra scan: %v", err)
+		}
+	}()
+
+	// Then
+	expectedString := "[trivy config --severity HIGH,CRITICAL --format json --ignorefile /code/.trivyignore --tf-vars /code/config/common.json --tf-vars /code/config/live.json /code/infra]"
+	if strings.TrimSpace(errorBuffer.String()) != expectedString {
+		t.Errorf("expected output %s, got: %s", expectedString, errorBuffer.String())
+	}
 }
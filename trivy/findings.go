@@ -0,0 +1,176 @@
+package trivy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Findings summarises the results of a scan of the repository or an image.
+type Findings struct {
+	// Counts is the number of findings of each severity.
+	Counts map[string]int `json:"counts"`
+	// Targets are the findings for each target scanned (e.g. a lock file or the OS packages in an image) that had any.
+	Targets []*TargetFindings `json:"targets"`
+	// Fail is true if there are findings of the fail severity or above, which count against the release.
+	Fail bool `json:"fail"`
+}
+
+// RELEASE_METADATA_FINDINGS is the key in the release section of the release metadata for the ReleaseFindings.
+const RELEASE_METADATA_FINDINGS = "security_findings"
+
+// ReleaseFindings are the findings from scanning the repository, the terraform code (if configured) and the image of
+// each build for a release.
+type ReleaseFindings struct {
+	Repository *Findings            `json:"repository,omitempty"`
+	Infra      *Findings            `json:"infra,omitempty"`
+	Builds     map[string]*Findings `json:"builds"`
+}
+
+// Fail returns true if any of the findings count against the release.
+func (findings *ReleaseFindings) Fail() bool {
+	if findings.Repository != nil && findings.Repository.Fail {
+		return true
+	}
+	if findings.Infra != nil && findings.Infra.Fail {
+		return true
+	}
+	for _, buildFindings := range findings.Builds {
+		if buildFindings.Fail {
+			return true
+		}
+	}
+	return false
+}
+
+// Table returns the findings keyed by what was scanned, for WriteFindingsTable.
+func (findings *ReleaseFindings) Table() map[string]*Findings {
+	result := make(map[string]*Findings)
+	if findings.Repository != nil {
+		result["repository"] = findings.Repository
+	}
+	if findings.Infra != nil {
+		result["infra"] = findings.Infra
+	}
+	for buildID, buildFindings := range findings.Builds {
+		result[buildID] = buildFindings
+	}
+	return result
+}
+
+// GetReleaseFindings returns the findings from the release metadata, or nil if there are none (e.g. the release was
+// made without trivy configured).
+func GetReleaseFindings(releaseMetadata map[string]map[string]string) (*ReleaseFindings, error) {
+	encoded, ok := releaseMetadata["release"][RELEASE_METADATA_FINDINGS]
+	if !ok {
+		return nil, nil
+	}
+	var result ReleaseFindings
+	if err := json.Unmarshal([]byte(encoded), &result); err != nil {
+		return nil, fmt.Errorf("error parsing %s from release metadata: %w", RELEASE_METADATA_FINDINGS, err)
+	}
+	return &result, nil
+}
+
+// TargetFindings are the findings for a single target within a scan.
+type TargetFindings struct {
+	Target string         `json:"target"`
+	Counts map[string]int `json:"counts"`
+	CVEs   []string       `json:"cves,omitempty"`
+}
+
+// report is the part of trivy's JSON output that is summarised.
+type report struct {
+	Results []struct {
+		Target          string
+		Vulnerabilities []struct {
+			VulnerabilityID string
+			Severity        string
+		}
+		Misconfigurations []struct {
+			Severity string
+			Status   string
+		}
+		Secrets []struct {
+			Severity string
+		}
+		Licenses []struct {
+			Severity string
+		}
+	}
+}
+
+// ParseFindings summarises trivy's JSON output, with findings of failSeverity or above counting against the release.
+func ParseFindings(data []byte, failSeverity string) (*Findings, error) {
+	var parsed report
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("error parsing trivy results: %w", err)
+	}
+	result := &Findings{Counts: map[string]int{}, Targets: []*TargetFindings{}}
+	failFrom := slices.Index(Severities, failSeverity)
+	for _, parsedResult := range parsed.Results {
+		target := &TargetFindings{Target: parsedResult.Target, Counts: map[string]int{}}
+		add := func(severity string) {
+			target.Counts[severity]++
+			result.Counts[severity]++
+			if slices.Index(Severities, severity) >= failFrom {
+				result.Fail = true
+			}
+		}
+		for _, vulnerability := range parsedResult.Vulnerabilities {
+			add(vulnerability.Severity)
+			if !slices.Contains(target.CVEs, vulnerability.VulnerabilityID) {
+				target.CVEs = append(target.CVEs, vulnerability.VulnerabilityID)
+			}
+		}
+		for _, misconfiguration := range parsedResult.Misconfigurations {
+			if misconfiguration.Status == "FAIL" {
+				add(misconfiguration.Severity)
+			}
+		}
+		for _, secret := range parsedResult.Secrets {
+			add(secret.Severity)
+		}
+		for _, license := range parsedResult.Licenses {
+			add(license.Severity)
+		}
+		if len(target.Counts) > 0 {
+			sort.Strings(target.CVEs)
+			result.Targets = append(result.Targets, target)
+		}
+	}
+	return result, nil
+}
+
+// WriteFindingsTable writes a table of findings keyed by what was scanned (e.g. "repository" or a build id).
+func WriteFindingsTable(outputStream io.Writer, findings map[string]*Findings) error {
+	names := make([]string, 0, len(findings))
+	for name := range findings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	severities := slices.Clone(Severities)
+	slices.Reverse(severities)
+
+	writer := tabwriter.NewWriter(outputStream, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "SCAN\tTARGET\t%s\tCVES\n", strings.Join(severities, "\t"))
+	for _, name := range names {
+		if len(findings[name].Targets) == 0 {
+			fmt.Fprintf(writer, "%s\t-\t%s\t\n", name, strings.Repeat("0\t", len(severities)-1)+"0")
+			continue
+		}
+		for _, target := range findings[name].Targets {
+			counts := make([]string, 0, len(severities))
+			for _, severity := range severities {
+				counts = append(counts, fmt.Sprint(target.Counts[severity]))
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", name, target.Target, strings.Join(counts, "\t"), strings.Join(target.CVEs, ", "))
+		}
+	}
+	return writer.Flush()
+}
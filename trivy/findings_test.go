@@ -0,0 +1,119 @@
+package trivy_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/trivy"
+)
+
+const trivyResults = `{
+	"SchemaVersion": 2,
+	"Results": [
+		{
+			"Target": "alpine:3.19 (alpine 3.19.1)",
+			"Vulnerabilities": [
+				{"VulnerabilityID": "CVE-2024-0002", "PkgName": "libcrypto3", "Severity": "CRITICAL"},
+				{"VulnerabilityID": "CVE-2024-0001", "PkgName": "libssl3", "Severity": "HIGH"},
+				{"VulnerabilityID": "CVE-2024-0001", "PkgName": "libcrypto3", "Severity": "HIGH"}
+			]
+		},
+		{
+			"Target": "Dockerfile",
+			"Misconfigurations": [
+				{"ID": "DS002", "Severity": "HIGH", "Status": "FAIL"},
+				{"ID": "DS001", "Severity": "MEDIUM", "Status": "PASS"}
+			]
+		},
+		{"Target": "package-lock.json"}
+	]
+}`
+
+func TestParseFindings(t *testing.T) {
+	findings, err := trivy.ParseFindings([]byte(trivyResults), "CRITICAL")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(findings.Counts, map[string]int{"CRITICAL": 1, "HIGH": 3}) {
+		t.Errorf("unexpected counts: %v", findings.Counts)
+	}
+	if !findings.Fail {
+		t.Error("expected findings to fail")
+	}
+	if len(findings.Targets) != 2 {
+		t.Fatalf("expected 2 targets with findings, got %d", len(findings.Targets))
+	}
+	if want := []string{"CVE-2024-0001", "CVE-2024-0002"}; !reflect.DeepEqual(findings.Targets[0].CVEs, want) {
+		t.Errorf("got CVEs %v, want %v", findings.Targets[0].CVEs, want)
+	}
+	if !reflect.DeepEqual(findings.Targets[1].Counts, map[string]int{"HIGH": 1}) {
+		t.Errorf("unexpected Dockerfile counts: %v", findings.Targets[1].Counts)
+	}
+
+	// no critical findings in the Dockerfile
+	findings, err = trivy.ParseFindings([]byte(`{"Results": [{"Target": "Dockerfile", "Misconfigurations": [{"Severity": "HIGH", "Status": "FAIL"}]}]}`), "CRITICAL")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if findings.Fail {
+		t.Error("expected findings not to fail")
+	}
+
+	if _, err := trivy.ParseFindings([]byte("not json"), "CRITICAL"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestWriteFindingsTable(t *testing.T) {
+	findings, err := trivy.ParseFindings([]byte(trivyResults), "CRITICAL")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var output bytes.Buffer
+	if err := trivy.WriteFindingsTable(&output, map[string]*trivy.Findings{
+		"repository": {Counts: map[string]int{}, Targets: []*trivy.TargetFindings{}},
+		"docker":     findings,
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got:\n%s", output.String())
+	}
+	for i, want := range [][]string{
+		{"SCAN", "TARGET", "CRITICAL", "HIGH", "MEDIUM", "LOW", "UNKNOWN", "CVES"},
+		{"docker", "alpine:3.19", "(alpine", "3.19.1)", "1", "2", "0", "0", "0", "CVE-2024-0001,", "CVE-2024-0002"},
+		{"docker", "Dockerfile", "0", "1", "0", "0", "0"},
+		{"repository", "-", "0", "0", "0", "0", "0"},
+	} {
+		if got := strings.Fields(lines[i]); !reflect.DeepEqual(got, want) {
+			t.Errorf("line %d: got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestGetReleaseFindings(t *testing.T) {
+	findings, err := trivy.GetReleaseFindings(map[string]map[string]string{"release": {}})
+	if err != nil || findings != nil {
+		t.Errorf("expected no findings, got %v, %v", findings, err)
+	}
+
+	findings, err = trivy.GetReleaseFindings(map[string]map[string]string{"release": {
+		trivy.RELEASE_METADATA_FINDINGS: `{"repository": {"counts": {}, "targets": [], "fail": false}, "builds": {"docker": {"counts": {"CRITICAL": 1}, "fail": true}}}`,
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !findings.Fail() {
+		t.Error("expected findings to fail")
+	}
+	if table := findings.Table(); len(table) != 2 || table["docker"].Counts["CRITICAL"] != 1 {
+		t.Errorf("unexpected table: %v", table)
+	}
+
+	if _, err := trivy.GetReleaseFindings(map[string]map[string]string{"release": {trivy.RELEASE_METADATA_FINDINGS: "{"}}); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,137 @@
+package userconfig
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/mergermarket/cdflow2/clean"
+	"github.com/mergermarket/cdflow2/command"
+	"github.com/mergermarket/cdflow2/deploy"
+	"github.com/mergermarket/cdflow2/destroy"
+	"github.com/mergermarket/cdflow2/diff"
+	"github.com/mergermarket/cdflow2/drift"
+	cinit "github.com/mergermarket/cdflow2/init"
+	"github.com/mergermarket/cdflow2/lock"
+	"github.com/mergermarket/cdflow2/output"
+	release "github.com/mergermarket/cdflow2/release/command"
+	"github.com/mergermarket/cdflow2/releases"
+	"github.com/mergermarket/cdflow2/rollback"
+	"github.com/mergermarket/cdflow2/shell"
+)
+
+// CommandArgs contains specific arguments to the config command.
+type CommandArgs struct {
+	Subcommand string
+}
+
+// ParseArgs parses command line arguments to the config subcommand.
+func ParseArgs(args []string) (*CommandArgs, error) {
+	if len(args) == 0 {
+		return nil, errors.New("config subcommand is missing (show)")
+	}
+	if args[0] != "show" {
+		return nil, errors.New("unknown config subcommand: " + args[0])
+	}
+	if len(args) > 1 {
+		return nil, errors.New("unknown config argument: " + args[1])
+	}
+	return &CommandArgs{Subcommand: args[0]}, nil
+}
+
+// Setting is the effective value of an option and where it came from.
+type Setting struct {
+	Section string
+	Option  string
+	Value   string
+	Source  string
+}
+
+// commandArgParsers returns the parser for each command that takes options (or defaults for them), in the order the
+// commands are listed in the help.
+func commandArgParsers() []*command.ArgParser {
+	return []*command.ArgParser{
+		cinit.NewArgParser(&cinit.CommandArgs{Variables: map[string]string{}}),
+		release.NewArgParser(&release.CommandArgs{ReleaseData: map[string]string{}}),
+		releases.NewArgParser(&releases.CommandArgs{}),
+		diff.NewArgParser(&diff.CommandArgs{}),
+		deploy.NewArgParser(&deploy.CommandArgs{}),
+		rollback.NewArgParser(&rollback.CommandArgs{}),
+		drift.NewArgParser(&drift.CommandArgs{}),
+		destroy.NewArgParser(&destroy.CommandArgs{}),
+		lock.NewArgParser(&lock.CommandArgs{}),
+		lock.NewUnlockArgParser(&lock.CommandArgs{}),
+		shell.NewArgParser(&shell.CommandArgs{}),
+		output.NewArgParser(&output.CommandArgs{}),
+		clean.NewArgParser(&clean.CommandArgs{}),
+	}
+}
+
+// GetSettings returns the options set by the global options in args (the command line, which is parsed up to the
+// command), the environment or the user defaults file. Options that aren't set have their built-in defaults.
+func GetSettings(args []string, lookupEnv func(string) (string, bool), defaults command.UserDefaults, defaultsSource string) ([]Setting, error) {
+	var result []Setting
+	trace := func(section string) func(option, value, source string) {
+		return func(option, value, source string) {
+			result = append(result, Setting{section, option, value, source})
+		}
+	}
+	sectionDefaults := func(section string) map[string][]string {
+		if values, ok := defaults[section]; ok {
+			return values
+		}
+		return map[string][]string{}
+	}
+
+	var ignored command.GlobalArgs
+	globalParser := command.NewGlobalArgParser(&ignored)
+	globalParser.LookupEnv = lookupEnv
+	globalParser.Defaults = sectionDefaults("global")
+	globalParser.DefaultsSource = defaultsSource
+	globalParser.Trace = trace("global")
+	if _, err := globalParser.Parse(args); err != nil {
+		return nil, err
+	}
+
+	for _, parser := range commandArgParsers() {
+		parser.LookupEnv = lookupEnv
+		parser.Defaults = sectionDefaults(parser.Name)
+		parser.DefaultsSource = defaultsSource
+		parser.Trace = trace(parser.Name)
+		if _, err := parser.Parse(nil); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// WriteSettings writes the settings in a table.
+func WriteSettings(outputStream io.Writer, settings []Setting) error {
+	if len(settings) == 0 {
+		fmt.Fprintln(outputStream, "No options are set, so all have their built-in defaults.")
+		return nil
+	}
+	writer := tabwriter.NewWriter(outputStream, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "COMMAND\tOPTION\tVALUE\tSOURCE")
+	for _, setting := range settings {
+		fmt.Fprintf(writer, "%s\t--%s\t%s\t%s\n", setting.Section, setting.Option, setting.Value, setting.Source)
+	}
+	return writer.Flush()
+}
+
+// RunCommand runs the config command. args is the whole command line, so that global options set on it are included.
+func RunCommand(outputStream io.Writer, args []string, lookupEnv func(string) (string, bool)) error {
+	defaults, defaultsSource, err := command.GetUserDefaults()
+	if err != nil {
+		return err
+	}
+	if defaultsSource != "" {
+		fmt.Fprintf(outputStream, "User defaults file: %s\n\n", defaultsSource)
+	}
+	settings, err := GetSettings(args, lookupEnv, defaults, defaultsSource)
+	if err != nil {
+		return err
+	}
+	return WriteSettings(outputStream, settings)
+}
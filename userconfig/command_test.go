@@ -0,0 +1,103 @@
+package userconfig_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/command"
+	"github.com/mergermarket/cdflow2/userconfig"
+)
+
+func TestParseArgs(t *testing.T) {
+	if _, err := userconfig.ParseArgs([]string{"show"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for name, args := range map[string][]string{
+		"no subcommand":      {},
+		"unknown subcommand": {"edit"},
+		"too many args":      {"show", "deploy"},
+	} {
+		t.Run("sad path - "+name, func(t *testing.T) {
+			if _, err := userconfig.ParseArgs(args); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestGetSettings(t *testing.T) {
+	env := map[string]string{"CDFLOW2_TERRAFORM_LOG_LEVEL": "DEBUG", "CDFLOW2_NO_PULL_CONFIG": "true"}
+	lookupEnv := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+	defaults := command.UserDefaults{
+		"global": {"no-pull-release": {"true"}, "component": {"from-file"}},
+		"deploy": {"terraform-log-level": {"INFO"}},
+	}
+
+	got, err := userconfig.GetSettings([]string{"--component", "from-args", "config", "show"}, lookupEnv, defaults, "config.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the settings for every command with a --terraform-log-level option are included, so just check a few
+	for _, want := range []userconfig.Setting{
+		{Section: "global", Option: "no-pull-config", Value: "true", Source: "environment variable CDFLOW2_NO_PULL_CONFIG"},
+		{Section: "global", Option: "no-pull-release", Value: "true", Source: "config.yaml"},
+		{Section: "global", Option: "component", Value: "from-file", Source: "config.yaml"},
+		{Section: "global", Option: "component", Value: "from-args", Source: "command line"},
+		{Section: "deploy", Option: "terraform-log-level", Value: "DEBUG", Source: "environment variable CDFLOW2_TERRAFORM_LOG_LEVEL"},
+		{Section: "release", Option: "terraform-log-level", Value: "DEBUG", Source: "environment variable CDFLOW2_TERRAFORM_LOG_LEVEL"},
+	} {
+		found := false
+		for _, setting := range got {
+			if reflect.DeepEqual(setting, want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected %+v in %+v", want, got)
+		}
+	}
+	for _, setting := range got {
+		if setting.Section == "deploy" && setting.Value == "INFO" {
+			t.Errorf("expected the environment to take precedence over the user defaults file, got %+v", setting)
+		}
+	}
+}
+
+func TestGetSettingsCommandLineOnlyOptions(t *testing.T) {
+	lookupEnv := func(key string) (string, bool) {
+		if key == "CDFLOW2_ACCEPT_FINDINGS" || key == "CDFLOW2_FORCE" {
+			return "true", true
+		}
+		return "", false
+	}
+	got, err := userconfig.GetSettings([]string{"config", "show"}, lookupEnv, command.UserDefaults{}, "config.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected options that can only be given on the command line to be ignored, got %+v", got)
+	}
+
+	defaults := command.UserDefaults{"deploy": {"accept-findings": {"true"}}}
+	if _, err := userconfig.GetSettings([]string{"config", "show"}, lookupEnv, defaults, "config.yaml"); err == nil {
+		t.Error("expected error for an option that can only be given on the command line in the user defaults file")
+	}
+}
+
+func TestWriteSettings(t *testing.T) {
+	var output bytes.Buffer
+	if err := userconfig.WriteSettings(&output, []userconfig.Setting{
+		{Section: "deploy", Option: "force", Value: "true", Source: "config.yaml"},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(output.String(), "deploy   --force  true   config.yaml") {
+		t.Errorf("unexpected output:\n%s", output.String())
+	}
+}
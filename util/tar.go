@@ -0,0 +1,77 @@
+package util
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractTar extracts a tar stream (e.g. from docker.Iface.CopyFromContainer) into dir, removing stripComponents
+// leading path components from each entry (like `tar --strip-components`).
+func ExtractTar(reader io.Reader, dir string, stripComponents int) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		parts := strings.Split(strings.Trim(filepath.ToSlash(header.Name), "/"), "/")
+		if len(parts) <= stripComponents {
+			continue
+		}
+		name := filepath.Join(parts[stripComponents:]...)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+		target := filepath.Join(dir, name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := extractFile(tarReader, target, header.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil && !errors.Is(err, os.ErrExist) {
+				return err
+			}
+		}
+	}
+}
+
+func extractFile(reader io.Reader, target string, mode os.FileMode) (returnedError error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			if returnedError != nil {
+				returnedError = fmt.Errorf("%w, also %v", returnedError, err)
+			} else {
+				returnedError = err
+			}
+		}
+	}()
+	_, err = io.Copy(file, reader)
+	return err
+}
@@ -0,0 +1,61 @@
+package util_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/util"
+)
+
+func writeTar(t *testing.T, files map[string]string) *bytes.Buffer {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := tar.NewWriter(&buffer)
+	for name, content := range files {
+		if err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buffer
+}
+
+func TestExtractTar(t *testing.T) {
+	dir := t.TempDir()
+	buffer := writeTar(t, map[string]string{
+		"release/release-metadata.json": "{}",
+		"release/infra/main.tf":         "# main",
+	})
+
+	if err := util.ExtractTar(buffer, dir, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, want := range map[string]string{
+		"release-metadata.json": "{}",
+		"infra/main.tf":         "# main",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("error reading %s: %v", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("got %q for %s, want %q", got, name, want)
+		}
+	}
+}
+
+func TestExtractTarOutsideDir(t *testing.T) {
+	buffer := writeTar(t, map[string]string{"release/../../escaped": "x"})
+	if err := util.ExtractTar(buffer, t.TempDir(), 1); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,71 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// SyncWriter serialises writes to a writer that is shared between goroutines.
+type SyncWriter struct {
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+// NewSyncWriter returns a SyncWriter that writes to writer.
+func NewSyncWriter(writer io.Writer) *SyncWriter {
+	return &SyncWriter{writer: writer}
+}
+
+// Write writes to the underlying writer.
+func (syncWriter *SyncWriter) Write(data []byte) (int, error) {
+	syncWriter.mutex.Lock()
+	defer syncWriter.mutex.Unlock()
+	return syncWriter.writer.Write(data)
+}
+
+// PrefixWriter adds a prefix to each line written to it, so that output from different sources can be told apart when
+// it is interleaved. Only whole lines are written to the underlying writer, except when Flush is called.
+type PrefixWriter struct {
+	writer io.Writer
+	prefix []byte
+	buffer []byte
+}
+
+// NewPrefixWriter returns a PrefixWriter that writes to writer.
+func NewPrefixWriter(writer io.Writer, prefix string) *PrefixWriter {
+	return &PrefixWriter{writer: writer, prefix: []byte(prefix)}
+}
+
+// Write buffers data, writing each complete line with the prefix.
+func (prefixWriter *PrefixWriter) Write(data []byte) (int, error) {
+	prefixWriter.buffer = append(prefixWriter.buffer, data...)
+	var lines []byte
+	for {
+		end := bytes.IndexByte(prefixWriter.buffer, '\n')
+		if end == -1 {
+			break
+		}
+		lines = append(lines, prefixWriter.prefix...)
+		lines = append(lines, prefixWriter.buffer[:end+1]...)
+		prefixWriter.buffer = prefixWriter.buffer[end+1:]
+	}
+	if len(lines) > 0 {
+		// a single write so that lines aren't split up by writes from other goroutines
+		if _, err := prefixWriter.writer.Write(lines); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// Flush writes any incomplete line that has been buffered.
+func (prefixWriter *PrefixWriter) Flush() error {
+	if len(prefixWriter.buffer) == 0 {
+		return nil
+	}
+	line := append(append([]byte{}, prefixWriter.prefix...), prefixWriter.buffer...)
+	prefixWriter.buffer = nil
+	_, err := prefixWriter.writer.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,29 @@
+package util_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/util"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var output bytes.Buffer
+	writer := util.NewPrefixWriter(&output, "[build] ")
+
+	for _, data := range []string{"first li", "ne\nsecond line\nthi", "rd"} {
+		if _, err := writer.Write([]byte(data)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if want := "[build] first line\n[build] second line\n"; output.String() != want {
+		t.Errorf("got %q, want %q", output.String(), want)
+	}
+
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "[build] first line\n[build] second line\n[build] third\n"; output.String() != want {
+		t.Errorf("got %q, want %q", output.String(), want)
+	}
+}
@@ -0,0 +1,178 @@
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/docker/distribution/reference"
+	"gopkg.in/yaml.v2"
+
+	"github.com/mergermarket/cdflow2/command"
+	"github.com/mergermarket/cdflow2/manifest"
+	"github.com/mergermarket/cdflow2/util"
+)
+
+// build IDs are used as terraform variable names, so must be valid terraform identifiers
+var buildIDPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*$`)
+
+// ParseArgs parses command line arguments to the validate subcommand.
+func ParseArgs(args []string) error {
+	if len(args) != 0 {
+		return errors.New("validate has no arguments")
+	}
+	return nil
+}
+
+// Check checks cdflow.yaml, the config files and the infra directory in codeDir, returning all problems found.
+func Check(codeDir string) []string {
+	loadedManifest, err := manifest.Load(codeDir)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	problems := checkUnknownKeys(codeDir)
+	problems = append(problems, CheckManifest(loadedManifest)...)
+
+	configFilesFolder := loadedManifest.ConfigFilesFolder
+	if configFilesFolder == "" {
+		configFilesFolder = "config/"
+	}
+	problems = append(problems, checkConfigFiles(path.Join(codeDir, configFilesFolder))...)
+	problems = append(problems, checkInfra(path.Join(codeDir, "infra"))...)
+
+	return problems
+}
+
+func checkUnknownKeys(codeDir string) []string {
+	data, err := os.ReadFile(path.Join(codeDir, "cdflow.yaml"))
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var strict manifest.Manifest
+	err = yaml.UnmarshalStrict(data, &strict)
+	if typeError, ok := err.(*yaml.TypeError); ok {
+		var problems []string
+		for _, message := range typeError.Errors {
+			problems = append(problems, "cdflow.yaml: "+message)
+		}
+		return problems
+	} else if err != nil {
+		return []string{"cdflow.yaml: " + err.Error()}
+	}
+	return nil
+}
+
+// CheckManifest checks the loaded cdflow.yaml for missing or invalid values.
+func CheckManifest(loadedManifest *manifest.Manifest) []string {
+	var problems []string
+
+	if loadedManifest.Version != 2 {
+		problems = append(problems, fmt.Sprintf("cdflow.yaml: version must be 2 for cdflow2, got %d", loadedManifest.Version))
+	}
+
+	problems = append(problems, checkImage("config > image", loadedManifest.Config.Image, true)...)
+	problems = append(problems, checkImage("terraform > image", loadedManifest.Terraform.Image, true)...)
+	problems = append(problems, checkImage("trivy > image", loadedManifest.Trivy.Image, false)...)
+
+	buildIDs := make([]string, 0, len(loadedManifest.Builds))
+	for buildID := range loadedManifest.Builds {
+		buildIDs = append(buildIDs, buildID)
+	}
+	sort.Strings(buildIDs)
+	for _, buildID := range buildIDs {
+		if !buildIDPattern.MatchString(buildID) {
+			problems = append(problems, fmt.Sprintf(
+				"cdflow.yaml: build id %q must start with a letter or underscore and contain only letters, digits, underscores and dashes", buildID,
+			))
+		}
+		problems = append(problems, checkImage("builds > "+buildID+" > image", loadedManifest.Builds[buildID].Image, true)...)
+		build := loadedManifest.Builds[buildID]
+		if _, err := build.TimeoutDuration(); err != nil {
+			problems = append(problems, fmt.Sprintf("cdflow.yaml: builds > %s > timeout: %v", buildID, err))
+		}
+		if build.Retries < 0 {
+			problems = append(problems, fmt.Sprintf("cdflow.yaml: builds > %s > retries must not be negative, got %d", buildID, build.Retries))
+		}
+	}
+	if _, err := manifest.BuildOrder(loadedManifest.Builds); err != nil {
+		problems = append(problems, "cdflow.yaml: "+err.Error())
+	}
+	for _, pattern := range loadedManifest.ProtectedEnvironments {
+		if _, err := path.Match(pattern, ""); err != nil {
+			problems = append(problems, fmt.Sprintf("cdflow.yaml: protected_environments: invalid pattern %q", pattern))
+		}
+	}
+
+	return problems
+}
+
+func checkImage(key, image string, required bool) []string {
+	if image == "" {
+		if required {
+			return []string{"cdflow.yaml: " + key + " is missing"}
+		}
+		return nil
+	}
+	if _, err := reference.ParseNormalizedNamed(image); err != nil {
+		return []string{fmt.Sprintf("cdflow.yaml: %s %q is not a valid image reference: %v", key, image, err)}
+	}
+	return nil
+}
+
+func checkConfigFiles(configFilesFolder string) []string {
+	filenames, err := filepath.Glob(path.Join(configFilesFolder, "*.json"))
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var problems []string
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		var vars map[string]interface{}
+		if err := json.Unmarshal(data, &vars); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: not a valid terraform var file (must be a JSON object): %v", filename, err))
+		}
+	}
+	return problems
+}
+
+func checkInfra(infraDir string) []string {
+	info, err := os.Stat(infraDir)
+	if os.IsNotExist(err) {
+		return []string{"infra directory is missing"}
+	} else if err != nil {
+		return []string{err.Error()}
+	} else if !info.IsDir() {
+		return []string{"infra is not a directory"}
+	}
+	if _, err := os.Stat(path.Join(infraDir, ".terraform.lock.hcl")); os.IsNotExist(err) {
+		return []string{"infra/.terraform.lock.hcl is missing (run terraform init in infra and commit it)"}
+	} else if err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+// RunCommand runs the validate command.
+func RunCommand(state *command.GlobalState) error {
+	problems := Check(state.CodeDir)
+	if len(problems) == 0 {
+		fmt.Fprintf(state.ErrorStream, "%s\n", util.FormatInfo("no problems found"))
+		return nil
+	}
+
+	fmt.Fprintf(state.ErrorStream, "%s\n\n", util.FormatWarning(fmt.Sprintf("%d problem(s) found:", len(problems))))
+	for _, problem := range problems {
+		fmt.Fprintf(state.ErrorStream, "  - %s\n", problem)
+	}
+	return command.Failure(1)
+}
@@ -0,0 +1,151 @@
+package validate_test
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mergermarket/cdflow2/manifest"
+	"github.com/mergermarket/cdflow2/validate"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		filename := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const validManifest = `version: 2
+config:
+  image: mergermarket/cdflow2-config-acuris
+terraform:
+  image: hashicorp/terraform:1.5.0
+builds:
+  docker:
+    image: mergermarket/cdflow2-build-docker-ecr
+`
+
+func TestCheckValid(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"cdflow.yaml":               validManifest,
+		"config/common.json":        `{"foo": "bar"}`,
+		"infra/.terraform.lock.hcl": "",
+	})
+
+	if problems := validate.Check(dir); len(problems) != 0 {
+		t.Errorf("expected no problems, got %q", problems)
+	}
+}
+
+func TestCheckReportsAllProblems(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"cdflow.yaml": `version: 2
+config:
+  image: mergermarket/cdflow2-config-acuris
+unknown_key: true
+builds:
+  bad.id:
+    image: "Not A Valid Image"
+`,
+		"config/live.json": `["not", "an", "object"]`,
+	})
+
+	problems := validate.Check(dir)
+
+	for _, expected := range []string{
+		"unknown_key",
+		"terraform > image is missing",
+		`build id "bad.id"`,
+		`builds > bad.id > image "Not A Valid Image" is not a valid image reference`,
+		"live.json: not a valid terraform var file",
+		"infra directory is missing",
+	} {
+		found := false
+		for _, problem := range problems {
+			if strings.Contains(problem, expected) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected a problem containing %q, got %q", expected, problems)
+		}
+	}
+}
+
+func TestCheckMissingLockFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"cdflow.yaml":   validManifest,
+		"infra/main.tf": "",
+	})
+
+	problems := validate.Check(dir)
+	if len(problems) != 1 || !strings.Contains(problems[0], ".terraform.lock.hcl is missing") {
+		t.Errorf("expected missing lock file problem, got %q", problems)
+	}
+}
+
+func TestCheckManifest(t *testing.T) {
+	problems := validate.CheckManifest(&manifest.Manifest{
+		Version:   1,
+		Config:    manifest.ImageWithParams{Image: "config"},
+		Terraform: manifest.Terraform{Image: "terraform"},
+	})
+	if !reflect.DeepEqual(problems, []string{"cdflow.yaml: version must be 2 for cdflow2, got 1"}) {
+		t.Errorf("unexpected problems: %q", problems)
+	}
+}
+
+func TestCheckManifestBuildDependencies(t *testing.T) {
+	problems := validate.CheckManifest(&manifest.Manifest{
+		Version:   2,
+		Config:    manifest.ImageWithParams{Image: "config"},
+		Terraform: manifest.Terraform{Image: "terraform"},
+		Builds: map[string]manifest.ImageWithParamsAndEnvVars{
+			"lambda": {Image: "lambda", DependsOn: []string{"layer"}},
+		},
+	})
+	if !reflect.DeepEqual(problems, []string{`cdflow.yaml: build "lambda" depends on "layer", which doesn't exist`}) {
+		t.Errorf("unexpected problems: %q", problems)
+	}
+}
+
+func TestCheckManifestBuildTimeoutAndRetries(t *testing.T) {
+	problems := validate.CheckManifest(&manifest.Manifest{
+		Version:   2,
+		Config:    manifest.ImageWithParams{Image: "config"},
+		Terraform: manifest.Terraform{Image: "terraform"},
+		Builds: map[string]manifest.ImageWithParamsAndEnvVars{
+			"docker": {Image: "docker", Timeout: "30m", Retries: 2},
+			"lambda": {Image: "lambda", Timeout: "soon", Retries: -1},
+		},
+	})
+	if !reflect.DeepEqual(problems, []string{
+		`cdflow.yaml: builds > lambda > timeout: invalid timeout "soon": time: invalid duration "soon"`,
+		"cdflow.yaml: builds > lambda > retries must not be negative, got -1",
+	}) {
+		t.Errorf("unexpected problems: %q", problems)
+	}
+}
+
+func TestCheckManifestProtectedEnvironments(t *testing.T) {
+	problems := validate.CheckManifest(&manifest.Manifest{
+		Version:               2,
+		Config:                manifest.ImageWithParams{Image: "config"},
+		Terraform:             manifest.Terraform{Image: "terraform"},
+		ProtectedEnvironments: []string{"live", "prod-[eu"},
+	})
+	if !reflect.DeepEqual(problems, []string{`cdflow.yaml: protected_environments: invalid pattern "prod-[eu"`}) {
+		t.Errorf("unexpected problems: %q", problems)
+	}
+}